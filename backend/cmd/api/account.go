@@ -0,0 +1,507 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/export"
+)
+
+// requestUserExportHandler queues an archive of everything stored about the
+// authenticated user. The export can be polled and, once ready, downloaded
+// until it expires.
+func (app *application) requestUserExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	userExport := &data.UserExport{UserID: user.Id}
+
+	err := app.models.Exports.Insert(userExport)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	payload := data.ExportUserDataPayload{ExportID: userExport.ID}
+
+	_, err = app.models.Jobs.Enqueue(data.JobKindExportUserData, payload, app.config.jobs.maxAttempts)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/exports/%d", userExport.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"export": userExport}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getUserExportHandler returns the status of one of the user's exports
+func (app *application) getUserExportHandler(w http.ResponseWriter, r *http.Request) {
+	userExport, ok := app.readUserExport(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"export": userExport}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadUserExportHandler serves the archive of a ready export
+func (app *application) downloadUserExportHandler(w http.ResponseWriter, r *http.Request) {
+	userExport, ok := app.readUserExport(w, r)
+	if !ok {
+		return
+	}
+
+	if userExport.Status != data.ExportStatusReady {
+		app.errorResponse(w, r, http.StatusConflict, "the export is not ready to download")
+		return
+	}
+
+	if userExport.ExpiresAt != nil && time.Now().After(*userExport.ExpiresAt) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	file, err := os.Open(userExport.FilePath)
+	if err != nil {
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer file.Close()
+
+	name := fmt.Sprintf("notes-export-%s", userExport.CreatedAt.UTC().Format("2006-01-02"))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", export.ContentDisposition(name, "zip"))
+
+	http.ServeContent(w, r, "", *userExport.CompletedAt, file)
+}
+
+// readUserExport looks up the export in the URL and checks that it belongs to
+// the authenticated user. It writes the error response itself and reports
+// whether the caller should carry on.
+func (app *application) readUserExport(w http.ResponseWriter, r *http.Request) (*data.UserExport, bool) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return nil, false
+	}
+
+	userExport, err := app.models.Exports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Another user's export is reported as missing rather than forbidden
+	if userExport.UserID != user.Id {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return userExport, true
+}
+
+// deleteCurrentUserHandler permanently deletes the authenticated user with all
+// their notes, audio, folders, chats and tokens, then confirms by email. The
+// password must be given again; users who only signed in through a social
+// provider have to set one through the password reset flow first.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	paths, err := app.models.Users.Delete(user.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The rows are gone, so files that can't be removed are only logged
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			app.logger.PrintError(err, map[string]string{
+				"user_id": strconv.FormatInt(user.Id, 10),
+				"path":    path,
+			})
+		}
+	}
+
+	err = os.RemoveAll(filepath.Join(".", "uploads", strconv.FormatInt(user.Id, 10)))
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"user_id": strconv.FormatInt(user.Id, 10),
+		})
+	}
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"name": user.Name,
+		}
+		err := app.mailer.Send(user.Email, "user_deleted.html", data)
+		if err != nil {
+			prop := make(map[string]string)
+			prop["User Deletion"] = fmt.Sprintf("User %d could not send deletion email", user.Id)
+			app.logger.PrintError(err, prop)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account and all of its data were deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportUserDataJob builds the archive of the export in the payload. It is
+// written next to the user's audio under a temporary name and renamed once
+// complete, so a ready export never points at a partial file.
+func (app *application) exportUserDataJob(ctx context.Context, job *data.Job) error {
+	var payload data.ExportUserDataPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	userExport, err := app.models.Exports.Get(payload.ExportID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			// The user was deleted while the job was waiting; nothing to do
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if userExport.Status != data.ExportStatusPending {
+		return nil
+	}
+
+	err = app.buildUserExport(ctx, userExport)
+	if err != nil {
+		if job.Attempts >= job.MaxAttempts && ctx.Err() == nil {
+			if err := app.models.Exports.MarkFailed(userExport, err); err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+				app.logger.PrintError(err, map[string]string{
+					"export_id": strconv.FormatInt(userExport.ID, 10),
+				})
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// buildUserExport writes the export's archive and marks it ready
+func (app *application) buildUserExport(ctx context.Context, userExport *data.UserExport) error {
+	user, err := app.models.Users.Retrieve(userExport.UserID)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(".", "uploads", strconv.FormatInt(user.Id, 10), "exports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(dir, fmt.Sprintf("%d.zip", userExport.ID))
+	tmpPath := filePath + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	err = app.writeUserArchive(ctx, zw, user)
+	if err != nil {
+		return err
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+
+	err = app.models.Exports.MarkReady(userExport, filePath, app.config.exports.ttl)
+	if err != nil {
+		os.Remove(filePath)
+		if errors.Is(err, data.ErrRcordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// writeUserArchive adds the user's profile, folders, chats, embedding
+// metadata and one directory per note with its exports, revisions and audio.
+// Notes and folders in the trash are included, as they are still stored.
+func (app *application) writeUserArchive(ctx context.Context, zw *zip.Writer, user *data.User) error {
+	socialAccounts, err := app.models.SocialAuth.GetByUserID(user.Id)
+	if err != nil {
+		return err
+	}
+	if socialAccounts == nil {
+		socialAccounts = []*data.SocialUser{}
+	}
+
+	err = writeArchiveJSON(zw, "profile.json", map[string]any{
+		"user":            user,
+		"social_accounts": socialAccounts,
+	})
+	if err != nil {
+		return err
+	}
+
+	folders, err := app.models.Folders.GetAllForUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(zw, "folders.json", folders); err != nil {
+		return err
+	}
+
+	folderNames := make(map[int64]string, len(folders))
+	for _, folder := range folders {
+		folderNames[folder.ID] = folder.Name
+	}
+
+	notes, err := app.models.Notes.GetAllForUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		// Audio makes the archive large, so give up between notes on shutdown
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err = app.writeNoteToUserArchive(zw, note, folderNames)
+		if err != nil {
+			return err
+		}
+	}
+
+	embeddings, err := app.models.Embeddings.GetMetadataForUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(zw, "embeddings.json", embeddings); err != nil {
+		return err
+	}
+
+	chats, err := app.userChats(user.Id)
+	if err != nil {
+		return err
+	}
+
+	return writeArchiveJSON(zw, "chats.json", chats)
+}
+
+// writeNoteToUserArchive adds a note's directory, named after its ID so titles
+// can repeat
+func (app *application) writeNoteToUserArchive(zw *zip.Writer, note *data.Note, folderNames map[int64]string) error {
+	dir := fmt.Sprintf("notes/%d-%s/", note.ID, export.Filename(note.Title))
+
+	segments, err := app.models.Segments.GetForNote(note.ID)
+	if err != nil {
+		return err
+	}
+
+	doc := export.Document{Note: note, Segments: segments}
+	if note.FolderID != nil {
+		doc.Folder = folderNames[*note.FolderID]
+	}
+
+	for _, format := range []string{export.FormatMarkdown, export.FormatJSON} {
+		body, err := export.Render(format, doc)
+		if err != nil {
+			return err
+		}
+
+		f, err := zw.Create(dir + "note." + format)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(body); err != nil {
+			return err
+		}
+	}
+
+	revisions, err := app.noteRevisions(note.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := writeArchiveJSON(zw, dir+"revisions.json", revisions); err != nil {
+		return err
+	}
+
+	return addAudioToArchive(zw, note, dir+"audio"+filepath.Ext(note.AudioFilePath))
+}
+
+// noteRevisions returns all revisions of a note, a page at a time
+func (app *application) noteRevisions(noteID int64) ([]*data.NoteRevision, error) {
+	filters := data.Filters{Page: 1, PageSize: 100}
+
+	revisions := []*data.NoteRevision{}
+	for {
+		page, _, err := app.models.Revisions.GetAllForNote(noteID, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, page...)
+		if len(page) < filters.PageSize {
+			return revisions, nil
+		}
+		filters.Page++
+	}
+}
+
+// userChat is a chat session together with its messages
+type userChat struct {
+	*data.ChatSession
+	Messages []*data.ChatMessage `json:"messages"`
+}
+
+// userChats returns all of the user's chat sessions with their messages
+func (app *application) userChats(userID int64) ([]userChat, error) {
+	filters := data.Filters{Page: 1, PageSize: 100}
+
+	chats := []userChat{}
+	for {
+		sessions, _, err := app.models.Chats.GetSessionsForUser(userID, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, session := range sessions {
+			messages, err := app.models.Chats.GetMessages(session.ID, 0)
+			if err != nil {
+				return nil, err
+			}
+
+			chats = append(chats, userChat{ChatSession: session, Messages: messages})
+		}
+
+		if len(sessions) < filters.PageSize {
+			return chats, nil
+		}
+		filters.Page++
+	}
+}
+
+// writeArchiveJSON adds v to the archive as an indented JSON file
+func writeArchiveJSON(zw *zip.Writer, name string, v any) error {
+	js, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(js, '\n'))
+	return err
+}
+
+// purgeExpiredExports deletes the exports that can no longer be downloaded
+// together with their archives
+func (app *application) purgeExpiredExports() {
+	paths, err := app.models.Exports.PurgeExpired()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"process": "purge_exports"})
+		return
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			app.logger.PrintError(err, map[string]string{
+				"process": "purge_exports",
+				"path":    path,
+			})
+		}
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/export"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+const (
+	// maxArchiveSize limits the size of an uploaded archive
+	maxArchiveSize = 1 << 30
+	// maxArchiveNotes limits how many audio files one archive may queue
+	maxArchiveNotes = 500
+	// maxAudioSize limits each audio file extracted from an archive, matching
+	// the limit on single uploads
+	maxAudioSize = 100 * 1024 * 1024
+)
+
+// errImportParentDeleted is recorded on an import whose folder was deleted
+// before the import ran
+var errImportParentDeleted = errors.New("the folder to import into was deleted")
+
+// audioExtensions are the audio formats that can be uploaded and imported
+var audioExtensions = []string{".mp3", ".wav", ".m4a", ".ogg"}
+
+// folderArchiveHandler streams a ZIP of a folder, its subfolders as nested
+// directories, and each note's audio together with its Markdown and JSON
+// export
+func (app *application) folderArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	folder, err := app.models.Folders.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Ensure the folder belongs to this user
+	if folder.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// Large folders take longer to stream than the server's write timeout
+	err = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", export.ContentDisposition(folder.Name, "zip"))
+	w.WriteHeader(http.StatusOK)
+
+	// The response has started, so failures can only be logged and leave the
+	// client with a truncated archive
+	zw := zip.NewWriter(w)
+	err = app.writeFolderArchive(zw, folder, export.Filename(folder.Name)+"/", map[int64]bool{})
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"folder_id": strconv.FormatInt(folder.ID, 10),
+		})
+	}
+}
+
+// writeFolderArchive adds the folder's notes under dir and recurses into its
+// subfolders. visited guards against cycles in the folder tree.
+func (app *application) writeFolderArchive(zw *zip.Writer, folder *data.Folder, dir string, visited map[int64]bool) error {
+	if visited[folder.ID] {
+		return nil
+	}
+	visited[folder.ID] = true
+
+	// An entry for the directory itself keeps empty folders in the archive
+	if _, err := zw.Create(dir); err != nil {
+		return err
+	}
+
+	notes, err := app.folderNotes(folder.UserID, folder.ID)
+	if err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+
+	for _, note := range notes {
+		base := uniqueName(export.Filename(note.Title), names)
+
+		segments, err := app.models.Segments.GetForNote(note.ID)
+		if err != nil {
+			return err
+		}
+
+		doc := export.Document{Note: note, Folder: folder.Name, Segments: segments}
+
+		for _, format := range []string{export.FormatMarkdown, export.FormatJSON} {
+			body, err := export.Render(format, doc)
+			if err != nil {
+				return err
+			}
+
+			f, err := zw.Create(dir + base + "." + format)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(body); err != nil {
+				return err
+			}
+		}
+
+		err = addAudioToArchive(zw, note, dir+base+filepath.Ext(note.AudioFilePath))
+		if err != nil {
+			return err
+		}
+	}
+
+	children, err := app.models.Folders.GetChildren(folder.ID, folder.UserID)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		name := uniqueName(export.Filename(child.Name), names)
+
+		err = app.writeFolderArchive(zw, child, dir+name+"/", visited)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addAudioToArchive copies the note's audio into the archive uncompressed, as
+// audio formats are already compressed. Notes whose audio is gone are skipped.
+func addAudioToArchive(zw *zip.Writer, note *data.Note, name string) error {
+	file, err := os.Open(note.AudioFilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: note.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, file)
+	return err
+}
+
+// folderNotes returns all notes in a folder, a page at a time
+func (app *application) folderNotes(userID, folderID int64) ([]*data.Note, error) {
+	filters := data.Filters{Page: 1, PageSize: 100}
+
+	var notes []*data.Note
+	for {
+		page, err := app.models.Notes.GetByFolder(userID, &folderID, "", filters)
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, page...)
+		if len(page) < filters.PageSize {
+			return notes, nil
+		}
+		filters.Page++
+	}
+}
+
+// uniqueName returns name, or name with a number appended if it is already
+// taken, and marks it as taken. Names are compared case-insensitively so the
+// archive extracts cleanly on case-insensitive file systems.
+func uniqueName(name string, taken map[string]bool) string {
+	unique := name
+	for i := 2; taken[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%s (%d)", name, i)
+	}
+	taken[strings.ToLower(unique)] = true
+
+	return unique
+}
+
+// importFolderHandler checks an uploaded ZIP, either an archive made by
+// folderArchiveHandler or a plain ZIP of audio files, and queues a job that
+// recreates its folders and queues every audio file in it for processing.
+// Audio files at the top of the archive go into a folder named after the
+// archive. The import can be polled until it is done.
+func (app *application) importFolderHandler(w http.ResponseWriter, r *http.Request) {
+	// httprouter can't register /v1/folders/import next to the /v1/folders/:id
+	// routes, so the import is routed as an id
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") != "import" {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("multipart form parsing error: %v", err))
+		return
+	}
+
+	// Use the requested pipeline, or the user's preferred one
+	pipeline := app.notePipeline(user, r.FormValue("pipeline"))
+
+	// "language" is the older name of summary_language
+	summaryLanguage := r.FormValue("summary_language")
+	if summaryLanguage == "" {
+		summaryLanguage = r.FormValue("language")
+	}
+
+	v := validator.New()
+	app.validatePipeline(v, pipeline)
+	languages := app.readNoteLanguages(v, pipeline, r.FormValue("transcript_language"), summaryLanguage)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get optional parent_id from form data; without it the folders are
+	// imported at the top level
+	var parentID *int64
+	if parentIDStr := r.FormValue("parent_id"); parentIDStr != "" {
+		id, err := strconv.ParseInt(parentIDStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid parent_id: %v", err))
+			return
+		}
+
+		parent, err := app.models.Folders.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Ensure the parent folder belongs to this user
+		if parent.UserID != user.Id {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		parentID = &parent.ID
+	}
+
+	file, header, err := r.FormFile("archive")
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("archive file is required: %v", err))
+		return
+	}
+	defer file.Close()
+
+	// Only the ZIP's directory is read here, so a bad archive is still rejected
+	// right away without extracting anything
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("archive is not a valid ZIP file: %v", err))
+		return
+	}
+
+	rootName := strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+	archive, err := export.ReadArchive(zr, export.Filename(rootName), audioExtensions)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v.Check(len(archive.Audio) <= maxArchiveNotes, "archive", fmt.Sprintf("must not contain more than %d audio files", maxArchiveNotes))
+	for _, a := range archive.Audio {
+		v.Check(a.File.UncompressedSize64 <= maxAudioSize, "archive", fmt.Sprintf("%s is larger than %d bytes", a.File.Name, maxAudioSize))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The archive is kept until the job has extracted it
+	archivePath, err := app.saveImportArchive(user.Id, file)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	folderImport := &data.FolderImport{
+		UserID:      user.Id,
+		ParentID:    parentID,
+		Name:        rootName,
+		ArchivePath: archivePath,
+	}
+
+	payload := data.ImportFolderPayload{
+		TranscriptLanguage: languages.Transcript,
+		SummaryLanguage:    languages.Summary,
+		Pipeline:           pipeline,
+	}
+
+	// The import and its job are created together, so the archive is only
+	// left behind for a job that will remove it
+	err = app.models.Imports.Insert(folderImport, payload, app.config.jobs.maxAttempts)
+	if err != nil {
+		os.Remove(archivePath)
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/imports/%d", folderImport.ID))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{
+		"import":  folderImport,
+		"message": "Archive uploaded successfully. Its folders and notes are created in the background.",
+	}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// saveImportArchive copies an uploaded archive under the user's uploads
+// directory and returns its path
+func (app *application) saveImportArchive(userID int64, src io.ReadSeeker) (string, error) {
+	dir := filepath.Join(".", "uploads", strconv.FormatInt(userID, 10), "imports")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	filePath := filepath.Join(dir, fmt.Sprintf("%d.zip", time.Now().UnixNano()))
+
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+// getFolderImportHandler returns the status of one of the user's imports
+func (app *application) getFolderImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	folderImport, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Another user's import is reported as missing rather than forbidden
+	if folderImport.UserID != user.Id {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"import": folderImport}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importFolderJob creates the folders and notes of the import in the payload.
+// The archive is removed once the import is done, or has failed for good.
+func (app *application) importFolderJob(ctx context.Context, job *data.Job) error {
+	var payload data.ImportFolderPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	folderImport, err := app.models.Imports.Get(payload.ImportID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			// The user was deleted while the job was waiting; nothing to do
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if folderImport.Status != data.ImportStatusPending {
+		return nil
+	}
+
+	// The folder to import into was moved to the trash or purged since the
+	// upload. Trying again won't bring it back, so the import fails for good.
+	if folderImport.HasParent {
+		if folderImport.ParentID == nil {
+			app.folderImportFailed(folderImport, errImportParentDeleted)
+			return nil
+		}
+
+		_, err := app.models.Folders.Get(*folderImport.ParentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.folderImportFailed(folderImport, errImportParentDeleted)
+				return nil
+			default:
+				return err
+			}
+		}
+	}
+
+	process := data.ProcessNoteAudioPayload{
+		TranscriptLanguage: payload.TranscriptLanguage,
+		SummaryLanguage:    payload.SummaryLanguage,
+		Pipeline:           payload.Pipeline,
+	}
+
+	err = app.buildFolderImport(ctx, folderImport, process)
+	if err != nil {
+		if errors.Is(err, data.ErrEditConflict) {
+			// An earlier run already completed the import
+			return nil
+		}
+		if job.Attempts >= job.MaxAttempts && ctx.Err() == nil {
+			app.folderImportFailed(folderImport, err)
+		}
+		return err
+	}
+
+	os.Remove(folderImport.ArchivePath)
+
+	return nil
+}
+
+// folderImportFailed marks the import as failed and removes its archive
+func (app *application) folderImportFailed(folderImport *data.FolderImport, importErr error) {
+	err := app.models.Imports.MarkFailed(folderImport, importErr)
+	if err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+		app.logger.PrintError(err, map[string]string{
+			"import_id": strconv.FormatInt(folderImport.ID, 10),
+		})
+	}
+
+	os.Remove(folderImport.ArchivePath)
+}
+
+// buildFolderImport extracts every audio file of the import's archive, then
+// creates its folders and notes and queues the notes for processing. The
+// extracted files are removed again if any of it fails.
+func (app *application) buildFolderImport(ctx context.Context, folderImport *data.FolderImport, process data.ProcessNoteAudioPayload) (err error) {
+	zr, err := zip.OpenReader(folderImport.ArchivePath)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	archive, err := export.ReadArchive(&zr.Reader, export.Filename(folderImport.Name), audioExtensions)
+	if err != nil {
+		return err
+	}
+
+	folders := make([]data.ImportedFolder, 0, len(archive.Dirs))
+	for _, dir := range archive.Dirs {
+		folders = append(folders, data.ImportedFolder{Path: dir, Name: truncateUTF8(path.Base(dir), 100)})
+	}
+
+	notes := make([]data.ImportedNote, 0, len(archive.Audio))
+	defer func() {
+		if err != nil {
+			for _, note := range notes {
+				os.Remove(note.AudioFilePath)
+			}
+		}
+	}()
+
+	for _, a := range archive.Audio {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		note, err := app.extractArchiveAudio(folderImport.UserID, a)
+		if err != nil {
+			return err
+		}
+		notes = append(notes, note)
+	}
+
+	return app.models.Imports.Complete(folderImport, folders, notes, process, app.config.jobs.maxAttempts)
+}
+
+// extractArchiveAudio saves one audio file of an archive under the user's
+// uploads directory
+func (app *application) extractArchiveAudio(userID int64, a export.ArchiveAudio) (data.ImportedNote, error) {
+	title := truncateUTF8(a.Title, 100)
+
+	rc, err := a.File.Open()
+	if err != nil {
+		return data.ImportedNote{}, err
+	}
+	defer rc.Close()
+
+	// The sizes in the ZIP headers can't be trusted, so the limit is enforced
+	// while extracting too
+	ext := strings.ToLower(path.Ext(a.File.Name))
+	filePath, err := app.saveAudioFile(userID, title, ext, io.LimitReader(rc, maxAudioSize+1))
+	if err != nil {
+		return data.ImportedNote{}, err
+	}
+
+	if info, err := os.Stat(filePath); err == nil && info.Size() > maxAudioSize {
+		os.Remove(filePath)
+		return data.ImportedNote{}, fmt.Errorf("%s is larger than %d bytes", a.File.Name, maxAudioSize)
+	}
+
+	return data.ImportedNote{Dir: a.Dir, Title: title, AudioFilePath: filePath}, nil
+}
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+
+	return s
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// Every message not yet folded into the session summary is sent to the LLM
+// verbatim, so no turn is ever left out of the prompt
+const (
+	// chatSummarizeAfter is how many messages may pile up outside the summary
+	// before the oldest of them are folded into it
+	chatSummarizeAfter = 12
+	// chatRecentMessages is how many of the latest messages stay outside the
+	// summary when the older ones are folded into it
+	chatRecentMessages = 6
+)
+
+// createChatHandler starts a new chat session over a folder, or over all of
+// the user's notes when no folder is given
+func (app *application) createChatHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title              string `json:"title"`
+		FolderID           *int64 `json:"folder_id"`
+		IncludeDescendants bool   `json:"include_descendants"`
+	}
+
+	err := app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &data.ChatSession{
+		UserID:             user.Id,
+		FolderID:           input.FolderID,
+		IncludeDescendants: input.IncludeDescendants,
+		Title:              strings.TrimSpace(input.Title),
+	}
+
+	if session.Title == "" {
+		session.Title = "New chat"
+	}
+
+	v := validator.New()
+	if data.ValidateChatSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Verify folder exists and belongs to the user
+	if session.FolderID != nil {
+		folder, err := app.models.Folders.Get(*session.FolderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if folder.UserID != user.Id {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	err = app.models.Chats.InsertSession(session)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/chats/%d", session.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"chat": session}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listChatsHandler returns the user's chat sessions, most recently active first
+func (app *application) listChatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sessions, metadata, err := app.models.Chats.GetSessionsForUser(user.Id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"chats": sessions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getChatHandler returns a chat session with its full conversation
+func (app *application) getChatHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUserChat(w, r)
+	if !ok {
+		return
+	}
+
+	messages, err := app.models.Chats.GetMessages(session.ID, 0)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"chat": session, "messages": messages}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteChatHandler removes a chat session and its messages
+func (app *application) deleteChatHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUserChat(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Chats.DeleteSession(session.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendChatMessageHandler continues a conversation. Follow-up questions are
+// rewritten into a standalone query before retrieval so that references to
+// earlier turns ("what did he say after that?") find the right chunks.
+func (app *application) sendChatMessageHandler(w http.ResponseWriter, r *http.Request) {
+	session, ok := app.readUserChat(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Content string `json:"content"`
+	}
+
+	err := app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	input.Content = strings.TrimSpace(input.Content)
+
+	v := validator.New()
+	v.Check(!session.Orphaned, "chat", "its folder was deleted, so it can no longer be asked questions")
+	v.Check(input.Content != "", "content", "must be provided")
+	v.Check(len(input.Content) <= 4000, "content", "must not be more than 4000 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only the turns that are not yet in the summary are needed
+	history, err := app.models.Chats.GetMessages(session.ID, session.SummarizedThrough)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	scope, err := app.chatScope(session)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	searchQuery := app.reformulateChatQuery(r.Context(), session, history, input.Content)
+
+	relevantChunks, err := app.retrieveChunks(r.Context(), searchQuery, scope)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	answer, err := app.ai.Chat.Complete(r.Context(), buildChatPrompt(session, history, input.Content, relevantChunks))
+	if err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to get answer from %s: %w", app.ai.Chat.Name(), err))
+		return
+	}
+
+	sources, err := json.Marshal(querySources(relevantChunks))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Both turns are stored only once the answer exists, so a failed LLM call
+	// leaves no unanswered question in the history
+	userMessage := &data.ChatMessage{
+		SessionID: session.ID,
+		Role:      data.ChatRoleUser,
+		Content:   input.Content,
+	}
+	if searchQuery != input.Content {
+		userMessage.SearchQuery = &searchQuery
+	}
+
+	assistantMessage := &data.ChatMessage{
+		SessionID: session.ID,
+		Role:      data.ChatRoleAssistant,
+		Content:   answer,
+		Sources:   sources,
+	}
+
+	err = app.models.Chats.InsertMessages(userMessage, assistantMessage)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Fold the oldest turns into the summary in the background once enough
+	// of them have piled up. A summary that is already pending will pick up
+	// these turns too.
+	if len(history)+2 > chatSummarizeAfter {
+		_, err = app.models.Jobs.Enqueue(data.JobKindSummarizeChat, data.SummarizeChatPayload{SessionID: session.ID}, app.config.jobs.maxAttempts)
+		if err != nil && !errors.Is(err, data.ErrDuplicateJob) {
+			app.logError(r, err)
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"message": userMessage, "reply": assistantMessage}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readUserChat loads the chat session named in the URL and checks that it
+// belongs to the current user. It writes the error response itself and
+// reports whether the handler may continue.
+func (app *application) readUserChat(w http.ResponseWriter, r *http.Request) (*data.ChatSession, bool) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return nil, false
+	}
+
+	session, err := app.models.Chats.GetSession(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if session.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return session, true
+}
+
+// chatScope returns the retrieval scope of a session. An orphaned session has
+// none, rather than falling back to all of the user's notes.
+func (app *application) chatScope(session *data.ChatSession) (data.ChunkQuery, error) {
+	scope := data.ChunkQuery{UserID: session.UserID}
+
+	if session.Orphaned {
+		return scope, errors.New("the chat's folder was deleted")
+	}
+
+	if session.FolderID == nil {
+		return scope, nil
+	}
+
+	scope.FolderIDs = []int64{*session.FolderID}
+
+	if session.IncludeDescendants {
+		folderIDs, err := app.models.Folders.GetSubtreeIDs(*session.FolderID)
+		if err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+			return scope, err
+		}
+		if err == nil {
+			scope.FolderIDs = folderIDs
+		}
+	}
+
+	return scope, nil
+}
+
+// reformulateChatQuery asks the LLM to turn a follow-up question into one that
+// can be searched without the conversation. The first question of a session,
+// or any failure, falls back to the question as asked.
+func (app *application) reformulateChatQuery(ctx context.Context, session *data.ChatSession, history []*data.ChatMessage, question string) string {
+	if session.Summary == "" && len(history) == 0 {
+		return question
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("Rewrite the user's last message as a standalone search query that can be understood without the conversation. ")
+	sb.WriteString("Replace pronouns and references to earlier turns with what they refer to. ")
+	sb.WriteString("Reply with the query only.\n\n")
+	writeChatHistory(&sb, session, history)
+	fmt.Fprintf(&sb, "\nLast message: %s", question)
+
+	query, err := app.ai.Chat.Complete(ctx, sb.String())
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"chat_id": fmt.Sprintf("%d", session.ID),
+			"process": "reformulate_chat_query",
+		})
+		return question
+	}
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return question
+	}
+
+	return query
+}
+
+// buildChatPrompt asks for a cited answer to the question in the context of
+// the conversation so far
+func buildChatPrompt(session *data.ChatSession, history []*data.ChatMessage, question string, chunks []*data.RetrievedChunk) string {
+	var sb strings.Builder
+
+	sb.WriteString("You are continuing a conversation about the user's voice notes.\n\n")
+	writeChatHistory(&sb, session, history)
+	sb.WriteString("\n")
+	writeCitationInstructions(&sb, chunks)
+	fmt.Fprintf(&sb, "\nQuestion: %s", question)
+
+	return sb.String()
+}
+
+// writeChatHistory writes the session summary and every turn since it
+func writeChatHistory(sb *strings.Builder, session *data.ChatSession, history []*data.ChatMessage) {
+	if session.Summary != "" {
+		fmt.Fprintf(sb, "Summary of the earlier conversation: %s\n\n", session.Summary)
+	}
+
+	if len(history) == 0 {
+		return
+	}
+
+	sb.WriteString("Conversation:\n")
+	for _, message := range history {
+		fmt.Fprintf(sb, "%s: %s\n", message.Role, message.Content)
+	}
+}
+
+// summarizeChatJob folds every turn but the most recent ones into the
+// session's rolling summary
+func (app *application) summarizeChatJob(ctx context.Context, job *data.Job) error {
+	var payload data.SummarizeChatPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	session, err := app.models.Chats.GetSession(payload.SessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			// The chat was deleted while the job was waiting; nothing to do
+			return nil
+		default:
+			return err
+		}
+	}
+
+	history, err := app.models.Chats.GetMessages(session.ID, session.SummarizedThrough)
+	if err != nil {
+		return err
+	}
+
+	if len(history) <= chatRecentMessages {
+		return nil
+	}
+
+	older := history[:len(history)-chatRecentMessages]
+
+	var sb strings.Builder
+
+	sb.WriteString("Update the summary of a conversation between a user and an assistant about the user's voice notes. ")
+	sb.WriteString("Keep names, numbers, decisions and what each question referred to. ")
+	sb.WriteString("Reply with the updated summary only, in at most 200 words.\n\n")
+	if session.Summary != "" {
+		fmt.Fprintf(&sb, "Current summary: %s\n\n", session.Summary)
+	}
+	sb.WriteString("New turns:\n")
+	for _, message := range older {
+		fmt.Fprintf(&sb, "%s: %s\n", message.Role, message.Content)
+	}
+
+	summary, err := app.ai.Chat.Complete(ctx, sb.String())
+	if err != nil {
+		return fmt.Errorf("summarize chat: %w", err)
+	}
+
+	session.Summary = strings.TrimSpace(summary)
+	session.SummarizedThrough = older[len(older)-1].ID
+
+	err = app.models.Chats.UpdateSummary(session)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			// Another job summarized the session first
+			return nil
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/events"
+)
+
+// sseHeartbeatInterval keeps idle streams alive through proxies
+const sseHeartbeatInterval = 15 * time.Second
+
+// noteEventsHandler streams the processing events of a single note as
+// Server-Sent Events
+func (app *application) noteEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	app.streamEvents(w, r, user.Id, note)
+}
+
+// userEventsHandler streams the processing events of all the user's notes
+func (app *application) userEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	app.streamEvents(w, r, user.Id, nil)
+}
+
+// streamEvents writes hub events for the user until the client disconnects or
+// the server shuts down. When note is set only that note's events are sent,
+// starting with its current status.
+func (app *application) streamEvents(w http.ResponseWriter, r *http.Request, userID int64, note *data.Note) {
+	sub := app.events.Subscribe(userID)
+	defer app.events.Unsubscribe(sub)
+
+	rc, err := app.startSSE(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if note != nil {
+		err = app.writeEvent(w, noteStatusEvent(note))
+		if err != nil {
+			return
+		}
+	}
+
+	err = rc.Flush()
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-app.shutdown:
+			return
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-sub.C:
+			if note != nil && event.NoteID != note.ID {
+				continue
+			}
+			err = app.writeEvent(w, event)
+		}
+
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a single hub event in the Server-Sent Events wire format
+func (app *application) writeEvent(w http.ResponseWriter, event events.Event) error {
+	return app.writeSSE(w, event.Type, event)
+}
+
+// writeSSE writes payload as JSON under the given event name
+func (app *application) writeSSE(w http.ResponseWriter, eventType string, payload any) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", eventType, js)
+	return err
+}
+
+// startSSE prepares a long-lived Server-Sent Events response and sends its
+// headers
+func (app *application) startSSE(w http.ResponseWriter) (*http.ResponseController, error) {
+	rc := http.NewResponseController(w)
+
+	// Long-lived streams must not be cut off by the server's write timeout
+	err := rc.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	return rc, nil
+}
+
+// publishNoteEvent sends a note event to the note owner's subscribers
+func (app *application) publishNoteEvent(note *data.Note, eventType string, payload any) {
+	app.events.Publish(events.Event{
+		Type:   eventType,
+		NoteID: note.ID,
+		UserID: note.UserID,
+		Data:   payload,
+	})
+}
+
+// noteStatusEvent describes the current processing stage of a note
+func noteStatusEvent(note *data.Note) events.Event {
+	return events.Event{
+		Type:   events.TypeStatus,
+		NoteID: note.ID,
+		UserID: note.UserID,
+		Data: envelope{
+			"status":          note.Status,
+			"status_error":    note.StatusError,
+			"transcribing_at": note.TranscribingAt,
+			"summarizing_at":  note.SummarizingAt,
+			"embedding_at":    note.EmbeddingAt,
+			"ready_at":        note.ReadyAt,
+			"failed_at":       note.FailedAt,
+		},
+	}
+}
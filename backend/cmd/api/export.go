@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/export"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// exportNoteHandler downloads a note as SRT or WebVTT captions, Markdown,
+// plain text or JSON, chosen with the format query parameter
+func (app *application) exportNoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	format := app.readString(r.URL.Query(), "format", export.FormatMarkdown)
+
+	v := validator.New()
+	v.Check(validator.In(format, export.Formats...), "format", fmt.Sprintf("must be one of %s", strings.Join(export.Formats, ", ")))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	segments, err := app.models.Segments.GetForNote(note.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v.Check(note.Transcript.Valid, "format", "note has no transcript to export yet")
+	if export.IsCaptions(format) {
+		v.Check(len(segments) > 0, "format", "captions need a transcript with timed segments")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	doc := export.Document{Note: note, Segments: segments}
+
+	if note.FolderID != nil {
+		folder, err := app.models.Folders.Get(*note.FolderID)
+		if err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if folder != nil {
+			doc.Folder = folder.Name
+		}
+	}
+
+	body, err := export.Render(format, doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", export.ContentDisposition(note.Title, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
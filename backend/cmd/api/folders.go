@@ -4,12 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/m0hh/Notes/internal/data"
 	"github.com/m0hh/Notes/internal/validator"
-	"github.com/pgvector/pgvector-go"
 )
 
 // createFolderHandler handles creation of new folders
@@ -183,8 +183,6 @@ func (app *application) updateFolderHandler(w http.ResponseWriter, r *http.Reque
 			return
 		}
 
-		// TODO: For a more complete solution, check if the new parent is a descendant of this folder
-
 		// Check that the new parent exists and belongs to the user
 		if *input.ParentID > 0 {
 			parentFolder, err := app.models.Folders.Get(*input.ParentID)
@@ -203,6 +201,18 @@ func (app *application) updateFolderHandler(w http.ResponseWriter, r *http.Reque
 				app.notPermittedResponse(w, r)
 				return
 			}
+
+			// Moving a folder under one of its own descendants would create a cycle
+			subtree, err := app.models.Folders.GetSubtreeIDs(folder.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if slices.Contains(subtree, *input.ParentID) {
+				app.badRequestResponse(w, r, fmt.Errorf("a folder cannot be moved into one of its subfolders"))
+				return
+			}
 		}
 
 		folder.ParentID = input.ParentID
@@ -271,14 +281,19 @@ func (app *application) deleteFolderHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Delete the folder
-	err = app.models.Folders.Delete(id)
+	// Move the folder, its subfolders and their notes to the trash
+	err = app.models.Folders.SoftDelete(folder)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "folder successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "folder moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -418,22 +433,46 @@ func (app *application) moveNoteHandler(w http.ResponseWriter, r *http.Request)
 
 // queryFolderHandler handles querying a folder with an LLM
 func (app *application) queryFolderHandler(w http.ResponseWriter, r *http.Request) {
+	question, scope, ok := app.readFolderQuery(w, r)
+	if !ok {
+		return
+	}
+
+	app.answerQuery(w, r, question, scope)
+}
+
+// streamQueryFolderHandler answers a folder query as Server-Sent Events,
+// forwarding the answer while it is generated
+func (app *application) streamQueryFolderHandler(w http.ResponseWriter, r *http.Request) {
+	question, scope, ok := app.readFolderQuery(w, r)
+	if !ok {
+		return
+	}
+
+	app.streamAnswer(w, r, question, scope)
+}
+
+// readFolderQuery reads and validates a folder query request and resolves the
+// folders it searches. It writes the error response itself and reports
+// whether the handler may continue.
+func (app *application) readFolderQuery(w http.ResponseWriter, r *http.Request) (string, data.ChunkQuery, bool) {
 	// Read folder_id from the URL path
 	params := httprouter.ParamsFromContext(r.Context())
 	folderID, err := strconv.ParseInt(params.ByName("id"), 10, 64)
 	if err != nil || folderID < 1 {
 		app.notFoundResponse(w, r)
-		return
+		return "", data.ChunkQuery{}, false
 	}
 
 	// Read JSON request body
 	var input struct {
-		Query string `json:"query"`
+		Query              string `json:"query"`
+		IncludeDescendants bool   `json:"include_descendants"`
 	}
 	err = app.ReadJSON(w, r, &input)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return "", data.ChunkQuery{}, false
 	}
 
 	// Validate query
@@ -441,14 +480,14 @@ func (app *application) queryFolderHandler(w http.ResponseWriter, r *http.Reques
 	v.Check(input.Query != "", "query", "must be provided")
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
-		return
+		return "", data.ChunkQuery{}, false
 	}
 
 	// Get the user from context
 	user := app.contextGetUser(r)
 	if user.Id == 0 {
 		app.authenticationRequiredResponse(w, r)
-		return
+		return "", data.ChunkQuery{}, false
 	}
 
 	// Verify folder exists and belongs to the user
@@ -460,68 +499,31 @@ func (app *application) queryFolderHandler(w http.ResponseWriter, r *http.Reques
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
-		return
+		return "", data.ChunkQuery{}, false
 	}
 	if folder.UserID != user.Id {
 		app.notPermittedResponse(w, r)
-		return
+		return "", data.ChunkQuery{}, false
 	}
 
-	// Check if AI services are available
-	if app.ai == nil {
-		app.serverErrorResponse(w, r, fmt.Errorf("ai services not configured"))
-		return
-	}
-
-	// Check if Gemini API key is available for querying
-	if app.ai.GeminiAPIKey == "" {
-		app.serverErrorResponse(w, r, fmt.Errorf("gemini api key not configured"))
-		return
-	}
-
-	// Check if OpenAI API key is available for embeddings
-	if app.ai.OpenAIAPIKey == "" {
-		app.serverErrorResponse(w, r, fmt.Errorf("openai api key not configured for embeddings"))
-		return
-	}
-
-	// Generate embedding for the query
-	queryEmbeddingFloat, err := app.ai.GenerateOpenAIEmbedding(input.Query)
-	if err != nil {
-		app.serverErrorResponse(w, r, fmt.Errorf("failed to generate query embedding: %w", err))
-		return
-	}
-
-	// Convert []float32 to pgvector.Vector
-	queryEmbedding := pgvector.NewVector(queryEmbeddingFloat)
-
-	// Get relevant chunks using the embedding
-	relevantChunks, err := app.models.Embeddings.GetRelevantChunks(folderID, queryEmbedding, 5)
-	if err != nil {
-		app.serverErrorResponse(w, r, fmt.Errorf("failed to retrieve relevant chunks: %w", err))
-		return
-	}
+	folderIDs := []int64{folderID}
 
-	// Combine these chunks into a single contextText string
-	var contextText string
-	for _, chunk := range relevantChunks {
-		// The GetRelevantChunks method returns strings, not struct with Content field
-		contextText += chunk + "\n"
-	}
-
-	// Construct a prompt for an LLM
-	prompt := fmt.Sprintf("Based on the following information: %s. Please answer the question: %s. If the information is not present in the provided context, say so.", contextText, input.Query)
-
-	// Call Gemini for a response
-	answer, err := app.ai.AskLLM(prompt)
-	if err != nil {
-		app.serverErrorResponse(w, r, fmt.Errorf("failed to get answer from gemini: %w", err))
-		return
+	// Optionally search the notes of every subfolder too
+	if input.IncludeDescendants {
+		folderIDs, err = app.models.Folders.GetSubtreeIDs(folderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return "", data.ChunkQuery{}, false
+		}
 	}
 
-	// Return the LLM's answer as a JSON response
-	err = app.writeJSON(w, http.StatusOK, envelope{"answer": answer}, nil)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-	}
+	return input.Query, data.ChunkQuery{
+		UserID:    user.Id,
+		FolderIDs: folderIDs,
+	}, true
 }
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/m0hh/Notes/internal/validator"
@@ -25,6 +26,40 @@ func (app *application) ReadIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readIntParam reads a positive integer URL parameter such as a revision number
+func (app *application) readIntParam(r *http.Request, name string) (int, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	n, err := strconv.Atoi(params.ByName(name))
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return n, nil
+}
+
+// versionETag formats a record version as a strong ETag
+func versionETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// readIfMatch returns the record version sent in the If-Match header. ok is
+// false when the header is missing or is the "*" wildcard.
+func (app *application) readIfMatch(r *http.Request) (version int, ok bool, err error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+
+	header = strings.TrimPrefix(header, "W/")
+	version, err = strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil {
+		return 0, false, errors.New("invalid If-Match header")
+	}
+
+	return version, true, nil
+}
+
 type envelope map[string]any
 
 func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
@@ -131,6 +166,26 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// readDate parses a date query parameter given either as 2006-01-02 or as an
+// RFC 3339 timestamp. It returns nil when the parameter is absent.
+func (app *application) readDate(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+
+	v.AddError(key, "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp")
+	return nil
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var jobsProcessedTotal = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Total number of background jobs processed, by kind and result.",
+	},
+	[]string{"kind", "result"},
+)
+
+// maxJobBackoff caps the exponential retry delay of a failing job
+const maxJobBackoff = time.Hour
+
+// errNoteEdited is recorded on a note whose processing stopped because the
+// user edited it in the meantime
+var errNoteEdited = errors.New("the note was edited while it was being processed; reprocess it to run the pipeline again")
+
+// jobHandler runs one job. ctx is cancelled when the server shuts down, so
+// long provider calls give up instead of holding the shutdown.
+type jobHandler func(ctx context.Context, job *data.Job) error
+
+// jobHandlers maps every job kind to the function that runs it
+func (app *application) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		data.JobKindProcessNoteAudio:  app.processNoteAudioJob,
+		data.JobKindRegenerateSummary: app.regenerateSummaryJob,
+		data.JobKindEmbedNote:         app.embedNoteJob,
+		data.JobKindSummarizeChat:     app.summarizeChatJob,
+		data.JobKindExportUserData:    app.exportUserDataJob,
+		data.JobKindTranslateNote:     app.translateNoteJob,
+		data.JobKindImportFolder:      app.importFolderJob,
+	}
+}
+
+// startWorkers launches the job worker pool, the stale job reaper and the trash
+// purge. They stop claiming new work, and running jobs are cancelled, once
+// stopWorkers is called.
+func (app *application) startWorkers() {
+	app.jobsQuit = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-app.jobsQuit
+		cancel()
+	}()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	handlers := app.jobHandlers()
+
+	for i := 0; i < app.config.jobs.workers; i++ {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+
+		app.jobsWG.Add(1)
+		go app.runWorker(ctx, workerID, handlers)
+	}
+
+	app.jobsWG.Add(1)
+	go app.reapStaleJobs()
+
+	app.jobsWG.Add(1)
+	go app.purgeTrashLoop()
+
+	app.logger.PrintInfo("started job workers", map[string]string{
+		"workers": fmt.Sprintf("%d", app.config.jobs.workers),
+	})
+}
+
+// stopWorkers signals the workers to stop, which cancels the jobs in flight,
+// and waits for them to return until ctx is done
+func (app *application) stopWorkers(ctx context.Context) error {
+	close(app.jobsQuit)
+
+	done := make(chan struct{})
+	go func() {
+		app.jobsWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for job workers: %w", ctx.Err())
+	}
+}
+
+func (app *application) runWorker(ctx context.Context, workerID string, handlers map[string]jobHandler) {
+	defer app.jobsWG.Done()
+
+	ticker := time.NewTicker(app.config.jobs.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.jobsQuit:
+			return
+		default:
+		}
+
+		job, err := app.models.Jobs.Claim(workerID)
+		if err != nil {
+			if !errors.Is(err, data.ErrNoJobs) {
+				app.logger.PrintError(err, map[string]string{
+					"worker":  workerID,
+					"process": "claim_job",
+				})
+			}
+
+			select {
+			case <-app.jobsQuit:
+				return
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		app.runJob(ctx, job, handlers)
+	}
+}
+
+func (app *application) runJob(ctx context.Context, job *data.Job, handlers map[string]jobHandler) {
+	properties := map[string]string{
+		"job_id":   fmt.Sprintf("%d", job.ID),
+		"kind":     job.Kind,
+		"attempts": fmt.Sprintf("%d", job.Attempts),
+	}
+
+	var err error
+	handler, ok := handlers[job.Kind]
+	if !ok {
+		err = fmt.Errorf("no handler registered for job kind %q", job.Kind)
+	} else {
+		err = app.safeRunJob(ctx, handler, job)
+	}
+
+	// A job cut short by the shutdown didn't fail; it runs again on restart
+	if err != nil && ctx.Err() != nil {
+		if err := app.models.Jobs.Release(job); err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		app.logger.PrintInfo("released job interrupted by shutdown", properties)
+		return
+	}
+
+	if err == nil {
+		if err := app.models.Jobs.Complete(job); err != nil {
+			app.logger.PrintError(err, properties)
+		}
+		jobsProcessedTotal.WithLabelValues(job.Kind, "completed").Inc()
+		return
+	}
+
+	app.logger.PrintError(err, properties)
+
+	if err := app.models.Jobs.Fail(job, err, app.jobBackoff(job.Attempts)); err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+
+	if job.Status == data.JobStatusDead {
+		jobsProcessedTotal.WithLabelValues(job.Kind, "dead").Inc()
+		app.logger.PrintError(errors.New("job moved to dead-letter state"), properties)
+		return
+	}
+
+	jobsProcessedTotal.WithLabelValues(job.Kind, "retried").Inc()
+}
+
+// safeRunJob turns a panic inside a job handler into an ordinary job failure
+func (app *application) safeRunJob(ctx context.Context, handler jobHandler, job *data.Job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("job panicked: %s", rec)
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+// jobBackoff doubles the configured base delay for every attempt already made
+func (app *application) jobBackoff(attempts int) time.Duration {
+	backoff := app.config.jobs.backoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= maxJobBackoff {
+			return maxJobBackoff
+		}
+	}
+
+	return backoff
+}
+
+// reapStaleJobs periodically requeues jobs whose worker died mid-run
+func (app *application) reapStaleJobs() {
+	defer app.jobsWG.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.jobsQuit:
+			return
+		case <-ticker.C:
+			n, dead, err := app.models.Jobs.RequeueStale(app.config.jobs.lease)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{"process": "requeue_stale_jobs"})
+				continue
+			}
+			if n > 0 {
+				app.logger.PrintInfo("requeued stale jobs", map[string]string{
+					"count": fmt.Sprintf("%d", n),
+				})
+			}
+
+			for _, job := range dead {
+				jobsProcessedTotal.WithLabelValues(job.Kind, "dead").Inc()
+				app.staleJobDied(job)
+			}
+		}
+	}
+}
+
+// staleJobDied records the failure of a job that used its last attempt on a
+// worker that died, on the record the job was working on, as the job's own
+// handler would have after its last attempt
+func (app *application) staleJobDied(job *data.Job) {
+	properties := map[string]string{
+		"job_id": fmt.Sprintf("%d", job.ID),
+		"kind":   job.Kind,
+	}
+	app.logger.PrintError(errors.New("stale job moved to dead-letter state"), properties)
+
+	jobErr := errors.New(job.LastError.String)
+
+	// Every job kind names the record it works on in its payload
+	var payload struct {
+		NoteID        int64 `json:"note_id"`
+		ExportID      int64 `json:"export_id"`
+		TranslationID int64 `json:"translation_id"`
+		ImportID      int64 `json:"import_id"`
+	}
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		app.logger.PrintError(err, properties)
+		return
+	}
+
+	var err error
+	switch job.Kind {
+	case data.JobKindProcessNoteAudio, data.JobKindRegenerateSummary, data.JobKindEmbedNote:
+		var note *data.Note
+		note, err = app.models.Notes.Get(payload.NoteID)
+		if err == nil {
+			app.noteJobFailed(job, note, jobErr)
+		}
+	case data.JobKindExportUserData:
+		var userExport *data.UserExport
+		userExport, err = app.models.Exports.Get(payload.ExportID)
+		if err == nil && userExport.Status == data.ExportStatusPending {
+			err = app.models.Exports.MarkFailed(userExport, jobErr)
+		}
+	case data.JobKindTranslateNote:
+		var translation *data.NoteTranslation
+		translation, err = app.models.Translations.Get(payload.TranslationID)
+		if err == nil && translation.Status == data.TranslationStatusPending {
+			err = app.models.Translations.MarkFailed(translation, jobErr)
+		}
+	case data.JobKindImportFolder:
+		var folderImport *data.FolderImport
+		folderImport, err = app.models.Imports.Get(payload.ImportID)
+		if err == nil && folderImport.Status == data.ImportStatusPending {
+			app.folderImportFailed(folderImport, jobErr)
+		}
+	}
+
+	if err != nil && !errors.Is(err, data.ErrRcordNotFound) && !errors.Is(err, data.ErrEditConflict) {
+		app.logger.PrintError(err, properties)
+	}
+}
+
+// noteJobFailed records a failed note job on the note: it is retrying with the
+// error until the next attempt, or is marked as failed once the job has used
+// its last attempt. A job that lost to the user's edit is failed without a
+// retry. A job cancelled by the shutdown leaves the note as it is, since it
+// runs again.
+func (app *application) noteJobFailed(job *data.Job, note *data.Note, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	// The user's edit wins over the pipeline's results, and running the job
+	// again would overwrite it, so the job stops here
+	if errors.Is(err, data.ErrEditConflict) {
+		app.setNoteStatus(note, data.NoteStatusFailed, errNoteEdited)
+		return nil
+	}
+
+	status := data.NoteStatusRetrying
+	if job.Attempts >= job.MaxAttempts {
+		status = data.NoteStatusFailed
+	}
+	app.setNoteStatus(note, status, err)
+
+	return err
+}
+
+// processNoteAudioJob runs the audio pipeline for the note in the payload
+func (app *application) processNoteAudioJob(ctx context.Context, job *data.Job) error {
+	var payload data.ProcessNoteAudioPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	note, err := app.models.Notes.Get(payload.NoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			// The note was deleted while the job was waiting; nothing to do
+			return nil
+		default:
+			return err
+		}
+	}
+
+	pipeline, err := app.ai.Pipeline(payload.Pipeline)
+	if err != nil {
+		return app.noteJobFailed(job, note, err)
+	}
+
+	languages := noteLanguages{
+		Transcript: payload.TranscriptLanguage,
+		Summary:    payload.SummaryLanguage,
+	}
+
+	err = app.processNoteAudio(ctx, note, pipeline, payload.Prompt, languages, payload.Reprocess)
+	if err != nil {
+		return app.noteJobFailed(job, note, err)
+	}
+
+	return nil
+}
+
+// regenerateSummaryJob summarizes the existing transcript of the note in the
+// payload again
+func (app *application) regenerateSummaryJob(ctx context.Context, job *data.Job) error {
+	var payload data.RegenerateSummaryPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	note, err := app.models.Notes.Get(payload.NoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	pipeline, err := app.ai.Pipeline(payload.Pipeline)
+	if err != nil {
+		return app.noteJobFailed(job, note, err)
+	}
+
+	err = app.regenerateNoteSummary(ctx, note, pipeline, payload.Prompt, payload.SummaryLanguage)
+	if err != nil {
+		return app.noteJobFailed(job, note, err)
+	}
+
+	return nil
+}
+
+// embedNoteJob rebuilds the embeddings of the note in the payload from its
+// current transcript
+func (app *application) embedNoteJob(ctx context.Context, job *data.Job) error {
+	var payload data.EmbedNotePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	note, err := app.models.Notes.Get(payload.NoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	err = app.embedNoteTranscript(ctx, note)
+	if err != nil {
+		return app.noteJobFailed(job, note, err)
+	}
+
+	app.setNoteStatus(note, data.NoteStatusReady, nil)
+
+	return nil
+}
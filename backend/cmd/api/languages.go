@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/m0hh/Notes/internal/ai"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// noteLanguages are the BCP-47 tags a note is processed with. An empty
+// Transcript has the spoken language detected; an empty Summary writes the
+// summary in the spoken language.
+type noteLanguages struct {
+	Transcript string
+	Summary    string
+}
+
+// readNoteLanguages parses the requested transcript and summary languages and
+// checks them against the languages the pipeline's providers declare. Older
+// clients send the summary language as "english" or "arabic", which still
+// parse. An unknown pipeline is left for validatePipeline to report.
+func (app *application) readNoteLanguages(v *validator.Validator, pipelineName, transcript, summary string) noteLanguages {
+	var languages noteLanguages
+
+	pipeline, err := app.ai.Pipeline(pipelineName)
+	if err != nil {
+		return languages
+	}
+
+	if transcript != "" {
+		languages.Transcript = validateLanguage(v, "transcript_language", transcript, pipeline.Name, pipeline.TranscriptLanguages())
+	}
+	if summary != "" {
+		languages.Summary = validateLanguage(v, "summary_language", summary, pipeline.Name, pipeline.SummaryLanguages())
+	}
+
+	return languages
+}
+
+// validateLanguage parses a language tag and checks that it is one of the
+// pipeline's supported languages. It returns the canonical tag, or an empty
+// string after recording the error under key.
+func validateLanguage(v *validator.Validator, key, value, pipeline string, supported []string) string {
+	tag, err := ai.ParseLanguage(value)
+	switch {
+	case err != nil:
+		v.AddError(key, "must be a BCP-47 language tag such as en or pt-BR")
+	case !ai.LanguageSupported(supported, tag):
+		v.AddError(key, fmt.Sprintf("%s is not supported by the %s pipeline", ai.LanguageName(tag), pipeline))
+	default:
+		return tag
+	}
+
+	return ""
+}
+
+// listLanguagesHandler returns the transcript and summary languages each
+// pipeline supports
+func (app *application) listLanguagesHandler(w http.ResponseWriter, r *http.Request) {
+	type pipelineLanguages struct {
+		Pipeline            string        `json:"pipeline"`
+		TranscriptLanguages []ai.Language `json:"transcript_languages"`
+		SummaryLanguages    []ai.Language `json:"summary_languages"`
+	}
+
+	pipelines := []pipelineLanguages{}
+	for _, name := range app.ai.PipelineNames() {
+		pipeline, err := app.ai.Pipeline(name)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		pipelines = append(pipelines, pipelineLanguages{
+			Pipeline:            pipeline.Name,
+			TranscriptLanguages: ai.Languages(pipeline.TranscriptLanguages()),
+			SummaryLanguages:    ai.Languages(pipeline.SummaryLanguages()),
+		})
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"pipelines": pipelines}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -16,6 +16,7 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/m0hh/Notes/internal/ai"
 	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/events"
 	"github.com/m0hh/Notes/internal/jsonlog"
 	"github.com/m0hh/Notes/internal/mailer"
 )
@@ -37,11 +38,38 @@ type AppConfig struct {
 		DeepseekAPIKey string `json:"deepseek_api_key"`
 		GeminiAPIKey   string `json:"gemini_api_key"`
 		OpenAIAPIKey   string `json:"openai_api_key"`
+		WhisperURL     string `json:"whisper_base_url"`
+		DeepseekURL    string `json:"deepseek_base_url"`
 	} `json:"api"`
 	Server struct {
 		Port               int      `json:"port"`
 		CorsTrustedOrigins []string `json:"cors_trusted_origins"`
 	} `json:"server"`
+	Jobs struct {
+		Workers     int `json:"workers"`
+		MaxAttempts int `json:"max_attempts"`
+	} `json:"jobs"`
+	Trash struct {
+		RetentionDays int `json:"retention_days"`
+	} `json:"trash"`
+	RAG struct {
+		TopK     int     `json:"top_k"`
+		MinScore float64 `json:"min_score"`
+	} `json:"rag"`
+	Ollama struct {
+		BaseURL        string `json:"base_url"`
+		ChatModel      string `json:"chat_model"`
+		EmbeddingModel string `json:"embedding_model"`
+	} `json:"ollama"`
+	WhisperCpp struct {
+		BaseURL string `json:"base_url"`
+	} `json:"whisper_cpp"`
+	Providers struct {
+		Transcription []string `json:"transcription"`
+		Chat          []string `json:"chat"`
+		Embedding     string   `json:"embedding"`
+	} `json:"providers"`
+	Pipelines map[string]ai.PipelineConfig `json:"pipelines"`
 }
 
 type config struct {
@@ -78,17 +106,52 @@ type config struct {
 		gcsBucketName  string
 		gcsEnabled     bool
 		gcsCredentials string
+
+		whisperURL  string
+		deepseekURL string
+
+		ollamaURL            string
+		ollamaChatModel      string
+		ollamaEmbeddingModel string
+		whisperCppURL        string
+
+		transcriptionProviders []string
+		chatProviders          []string
+		embeddingProvider      string
+		pipelines              map[string]ai.PipelineConfig
+	}
+	jobs struct {
+		workers      int
+		pollInterval time.Duration
+		maxAttempts  int
+		backoff      time.Duration
+		lease        time.Duration
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	exports struct {
+		ttl time.Duration
+	}
+	rag struct {
+		topK       int
+		candidates int
+		minScore   float64
 	}
 }
 
 type application struct {
-	config        config
-	logger        *jsonlog.Logger
-	models        data.Models
-	mailer        mailer.Mailer
-	wg            sync.WaitGroup
-	geminiService *ai.GeminiService
-	ai            *ai.AIService
+	config   config
+	logger   *jsonlog.Logger
+	models   data.Models
+	mailer   mailer.Mailer
+	wg       sync.WaitGroup
+	jobsWG   sync.WaitGroup
+	jobsQuit chan struct{}
+	shutdown chan struct{}
+	events   *events.Hub
+	ai       *ai.Registry
 }
 
 func main() {
@@ -121,6 +184,45 @@ func main() {
 	flag.BoolVar(&cfg.ai.gcsEnabled, "gcs-enabled", false, "Enable Google Cloud Storage for large audio files")
 	flag.StringVar(&cfg.ai.gcsCredentials, "gcs-credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "Path to Google Cloud credentials JSON file")
 
+	flag.IntVar(&cfg.jobs.workers, "jobs-workers", 4, "Number of background job workers")
+	flag.DurationVar(&cfg.jobs.pollInterval, "jobs-poll-interval", 2*time.Second, "How often idle workers poll for new jobs")
+	flag.IntVar(&cfg.jobs.maxAttempts, "jobs-max-attempts", 5, "Attempts before a job is moved to the dead-letter state")
+	flag.DurationVar(&cfg.jobs.backoff, "jobs-backoff", 30*time.Second, "Base retry delay for failed jobs, doubled on every attempt")
+	flag.DurationVar(&cfg.jobs.lease, "jobs-lease", 15*time.Minute, "How long a running job may be held before it is requeued")
+
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted notes and folders stay in the trash before they are purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is checked for items to purge")
+
+	flag.DurationVar(&cfg.exports.ttl, "export-ttl", 7*24*time.Hour, "How long a user data export can be downloaded before it is deleted")
+
+	flag.IntVar(&cfg.rag.topK, "rag-top-k", 5, "Number of transcript chunks given to the LLM when answering a query")
+	flag.IntVar(&cfg.rag.candidates, "rag-candidates", 50, "Chunks taken from each of the vector and keyword searches before fusion")
+	flag.Float64Var(&cfg.rag.minScore, "rag-min-score", 0, "Minimum normalized fusion score (0-1) for a chunk to be used as context")
+
+	flag.StringVar(&cfg.ai.whisperURL, "whisper-url", "https://api.openai.com/v1", "Base URL of an OpenAI-compatible Whisper API")
+	flag.StringVar(&cfg.ai.deepseekURL, "deepseek-url", "https://api.deepseek.com", "Base URL of the DeepSeek API")
+	flag.StringVar(&cfg.ai.ollamaURL, "ollama-url", os.Getenv("OLLAMA_URL"), "Base URL of an Ollama-compatible server")
+	flag.StringVar(&cfg.ai.ollamaChatModel, "ollama-chat-model", "llama3.1", "Ollama model used for chat and summaries")
+	flag.StringVar(&cfg.ai.ollamaEmbeddingModel, "ollama-embedding-model", "", "Ollama model used for embeddings (must produce 1536-dimension vectors)")
+	flag.StringVar(&cfg.ai.whisperCppURL, "whisper-cpp-url", os.Getenv("WHISPER_CPP_URL"), "Base URL of a whisper.cpp server")
+
+	cfg.ai.transcriptionProviders = []string{"gemini"}
+	cfg.ai.chatProviders = []string{"gemini"}
+	flag.Func("transcription-providers", "Transcription providers tried in order: gemini, whisper, whispercpp (comma separated, default gemini)", func(val string) error {
+		cfg.ai.transcriptionProviders = splitProviders(val)
+		return nil
+	})
+	flag.Func("chat-providers", "Chat and summarization providers tried in order: gemini, openai, deepseek, ollama (comma separated, default gemini)", func(val string) error {
+		cfg.ai.chatProviders = splitProviders(val)
+		return nil
+	})
+	flag.StringVar(&cfg.ai.embeddingProvider, "embedding-provider", "openai", "Embedding provider: openai or ollama")
+
+	// Pipelines a request or user can pick instead of the default one
+	cfg.ai.pipelines = map[string]ai.PipelineConfig{
+		"whisper": {Transcription: []string{"whisper"}, Summarization: []string{"deepseek"}},
+	}
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
 		cfg.cors.trustedOrigins = strings.Fields(val)
 		return nil
@@ -177,6 +279,52 @@ func main() {
 			cfg.ai.openaiAPIKey = appCfg.API.OpenAIAPIKey
 		}
 
+		if appCfg.Jobs.Workers != 0 {
+			cfg.jobs.workers = appCfg.Jobs.Workers
+		}
+		if appCfg.Jobs.MaxAttempts != 0 {
+			cfg.jobs.maxAttempts = appCfg.Jobs.MaxAttempts
+		}
+		if appCfg.Trash.RetentionDays != 0 {
+			cfg.trash.retention = time.Duration(appCfg.Trash.RetentionDays) * 24 * time.Hour
+		}
+		if appCfg.RAG.TopK != 0 {
+			cfg.rag.topK = appCfg.RAG.TopK
+		}
+		if appCfg.RAG.MinScore != 0 {
+			cfg.rag.minScore = appCfg.RAG.MinScore
+		}
+		if appCfg.API.WhisperURL != "" {
+			cfg.ai.whisperURL = appCfg.API.WhisperURL
+		}
+		if appCfg.API.DeepseekURL != "" {
+			cfg.ai.deepseekURL = appCfg.API.DeepseekURL
+		}
+		if appCfg.Ollama.BaseURL != "" {
+			cfg.ai.ollamaURL = appCfg.Ollama.BaseURL
+		}
+		if appCfg.Ollama.ChatModel != "" {
+			cfg.ai.ollamaChatModel = appCfg.Ollama.ChatModel
+		}
+		if appCfg.Ollama.EmbeddingModel != "" {
+			cfg.ai.ollamaEmbeddingModel = appCfg.Ollama.EmbeddingModel
+		}
+		if appCfg.WhisperCpp.BaseURL != "" {
+			cfg.ai.whisperCppURL = appCfg.WhisperCpp.BaseURL
+		}
+		if len(appCfg.Providers.Transcription) > 0 {
+			cfg.ai.transcriptionProviders = appCfg.Providers.Transcription
+		}
+		if len(appCfg.Providers.Chat) > 0 {
+			cfg.ai.chatProviders = appCfg.Providers.Chat
+		}
+		if appCfg.Providers.Embedding != "" {
+			cfg.ai.embeddingProvider = appCfg.Providers.Embedding
+		}
+		for name, pipeline := range appCfg.Pipelines {
+			cfg.ai.pipelines[name] = pipeline
+		}
+
 		// Always use GCS settings from config file if provided
 		cfg.ai.gcsEnabled = appCfg.GCS.Enabled
 		if appCfg.GCS.BucketName != "" {
@@ -213,28 +361,50 @@ func main() {
 		return time.Now().Unix()
 	}))
 
-	// Initialize Gemini service
-	geminiService := ai.NewGeminiService(cfg.ai.geminiAPIKey)
+	// Initialize the AI providers selected by the configuration
+	aiRegistry, err := ai.NewRegistry(ai.Config{
+		OpenAIAPIKey:   cfg.ai.openaiAPIKey,
+		GeminiAPIKey:   cfg.ai.geminiAPIKey,
+		WhisperAPIKey:  cfg.ai.whisperAPIKey,
+		DeepseekAPIKey: cfg.ai.deepseekAPIKey,
+
+		WhisperURL:  cfg.ai.whisperURL,
+		DeepseekURL: cfg.ai.deepseekURL,
+
+		OllamaURL:            cfg.ai.ollamaURL,
+		OllamaChatModel:      cfg.ai.ollamaChatModel,
+		OllamaEmbeddingModel: cfg.ai.ollamaEmbeddingModel,
+		WhisperCppURL:        cfg.ai.whisperCppURL,
+
+		Transcription: cfg.ai.transcriptionProviders,
+		Chat:          cfg.ai.chatProviders,
+		Embedding:     cfg.ai.embeddingProvider,
+
+		Pipelines: cfg.ai.pipelines,
+	})
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	logger.PrintInfo("AI providers initialized", map[string]string{
+		"transcription": aiRegistry.Transcriber.Name(),
+		"chat":          aiRegistry.Chat.Name(),
+		"embedding":     aiRegistry.Embedder.Name(),
+		"pipelines":     strings.Join(aiRegistry.PipelineNames(), ","),
+	})
 
 	// Check if Gemini API key is available
 	if cfg.ai.geminiAPIKey == "" {
 		logger.PrintInfo("Warning", map[string]string{
-			"message": "Gemini API key not provided; direct audio processing with Gemini will not be available",
+			"message": "Gemini API key not provided; Gemini providers will fail when used",
 		})
-	} else {
-		logger.PrintInfo("Gemini Pro 1.5 service initialized", nil)
 	}
 
-	// Initialize AI service
-	aiService := ai.NewAIService(cfg.ai.openaiAPIKey, cfg.ai.geminiAPIKey)
-
 	// Check if OpenAI API key is available
 	if cfg.ai.openaiAPIKey == "" {
 		logger.PrintInfo("Warning", map[string]string{
-			"message": "OpenAI API key not provided; embeddings and LLM features will not be available",
+			"message": "OpenAI API key not provided; OpenAI providers will fail when used",
 		})
-	} else {
-		logger.PrintInfo("OpenAI service initialized", nil)
 	}
 
 	// Create uploads directory if it doesn't exist
@@ -256,8 +426,8 @@ func main() {
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 		// transcriptionService: transcriptionService,
 		// summarizationService: summarizationService,
-		geminiService: geminiService,
-		ai:            aiService,
+		ai:     aiRegistry,
+		events: events.New(),
 	}
 
 	err = app.serve()
@@ -284,6 +454,17 @@ func loadConfig(path string, logger *jsonlog.Logger) (*AppConfig, error) {
 	return &cfg, nil
 }
 
+// splitProviders parses a comma separated list of provider names
+func splitProviders(val string) []string {
+	var names []string
+	for _, name := range strings.Split(val, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func openDB(cfg config) (*sql.DB, error) {
 	db, err := sql.Open("postgres", cfg.db.dsn)
 	if err != nil {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -8,16 +9,22 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp" // Import regexp package
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/m0hh/Notes/internal/ai"
 	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/events"
 	"github.com/m0hh/Notes/internal/validator"
 )
 
+// unsafeFilenameChars matches what is removed from titles used in file names
+var unsafeFilenameChars = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
 func (app *application) createNoteHandler(w http.ResponseWriter, r *http.Request) {
 	// Maximum file size: 50MB
 	const maxFileSize = 50 * 1024 * 1024
@@ -175,8 +182,129 @@ func (app *application) getNoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Return the note
-	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	// Return the note, with its version as the ETag for conditional updates
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(note.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateNoteHandler applies a partial update to a note's title, transcript or
+// summary. Clients must send the ETag they last saw in If-Match; a stale ETag
+// is rejected as an edit conflict.
+func (app *application) updateNoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	expectedVersion, hasVersion, err := app.readIfMatch(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	if !hasVersion {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if expectedVersion != note.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Title      *string `json:"title"`
+		Transcript *string `json:"transcript"`
+		Summary    *string `json:"summary"`
+	}
+
+	err = app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	transcriptChanged := false
+	contentChanged := false
+
+	if input.Title != nil && *input.Title != note.Title {
+		note.Title = *input.Title
+		contentChanged = true
+	}
+	if input.Transcript != nil && *input.Transcript != note.Transcript.String {
+		note.Transcript = sql.NullString{String: *input.Transcript, Valid: *input.Transcript != ""}
+		transcriptChanged = true
+		contentChanged = true
+	}
+	if input.Summary != nil && *input.Summary != note.Summary.String {
+		note.Summary = sql.NullString{String: *input.Summary, Valid: *input.Summary != ""}
+		contentChanged = true
+	}
+
+	v := validator.New()
+	if data.ValidateTitle(v, note.Title); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Notes.Update(note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if contentChanged {
+		app.recordRevision(note, data.RevisionSourceUserEdit, &user.Id)
+	}
+
+	// Re-chunk the corrected transcript so folder queries see the new text
+	if transcriptChanged {
+		_, err = app.models.Jobs.Enqueue(data.JobKindEmbedNote, data.EmbedNotePayload{NoteID: note.ID}, app.config.jobs.maxAttempts)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(note.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -194,6 +322,7 @@ func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request)
 	var input struct {
 		data.Filters
 		FolderID *int64
+		Status   string
 	}
 
 	v := validator.New()
@@ -202,6 +331,12 @@ func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readString(qs, "sort", "created_at")
 	input.Filters.SortSafelist = []string{"id", "title", "created_at", "-id", "-title", "-created_at"}
+	input.Status = app.readString(qs, "status", "")
+
+	// Only allow filtering on known processing statuses
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.NoteStatuses...), "status", "invalid status value")
+	}
 
 	// Parse optional folder_id filter
 	folderIDStr := r.URL.Query().Get("folder_id")
@@ -243,9 +378,9 @@ func (app *application) listNotesHandler(w http.ResponseWriter, r *http.Request)
 	var err error
 
 	if input.FolderID != nil {
-		notes, err = app.models.Notes.GetByFolder(user.Id, input.FolderID, input.Filters)
+		notes, err = app.models.Notes.GetByFolder(user.Id, input.FolderID, input.Status, input.Filters)
 	} else {
-		notes, err = app.models.Notes.GetAll(user.Id, input.Filters)
+		notes, err = app.models.Notes.GetAll(user.Id, input.Status, input.Filters)
 	}
 
 	if err != nil {
@@ -294,16 +429,15 @@ func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Delete the audio file
-	if err := os.Remove(note.AudioFilePath); err != nil && !os.IsNotExist(err) {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Delete the note from the database
-	err = app.models.Notes.Delete(id)
+	// Move the note to the trash; the audio file is removed when the trash is purged
+	err = app.models.Notes.SoftDelete(note)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
@@ -311,7 +445,8 @@ func (app *application) deleteNoteHandler(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// processAudioWithGeminiHandler handles audio summarization directly with Gemini Pro 1.5
+// processAudioWithGeminiHandler stores an uploaded audio file as a note and
+// queues it for transcription and summarization with the configured providers
 func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *http.Request) {
 	// Maximum file size: 100MB
 	const maxFileSize = 100 * 1024 * 1024
@@ -329,45 +464,8 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 		return
 	}
 
-	// Get the language from the form data (default to english)
-	language := r.FormValue("language")
-	if language == "" {
-		language = "english"
-	}
-
-	// Validate language (only allow english and arabic)
-	if language != "english" && language != "arabic" {
-		app.badRequestResponse(w, r, errors.New("language must be either 'english' or 'arabic'"))
-		return
-	}
-
-	// Get the prompt from the form data (optional with default)
+	// Optional custom instructions for the transcription and summary
 	prompt := r.FormValue("prompt")
-	if prompt == "" {
-		// Base prompt format
-		promptFormat := "Please transcribe this audio and provide a detailed summary of its content. Include key points and main topics. The format should be 1. the Transcript without any timestamps or any explanation at the begining that it's the transcipt  2. the Summary without any explanation at the begining that it's the summary. %s 3.the transcript and the summary are divided by these charachters ##**##"
-
-		// Add language-specific instruction
-		languageInstruction := ""
-		if language == "arabic" {
-			languageInstruction = "in Arabic language"
-		} else {
-			languageInstruction = "in the language that the transcript is in"
-		}
-
-		// Format the complete prompt
-		prompt = fmt.Sprintf(promptFormat, languageInstruction)
-	} else {
-		// For custom prompts, still ensure proper formatting for transcript/summary separator
-		languageInstruction := ""
-		if language == "arabic" {
-			languageInstruction = "in Arabic language"
-		} else {
-			languageInstruction = "in the language that the transcript is in"
-		}
-
-		prompt += fmt.Sprintf(". The format should be 1. the Transcript without any timestamps or any explanation at the begining that it's the transcipt  2. the Summary without any explanation at the begining that it's the summary. %s. 3.the transcript and the summary are divided by these charachters ##**##", languageInstruction)
-	}
 
 	// Get optional folder_id from form data
 	var folderID *int64
@@ -381,6 +479,17 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 		folderID = &id
 	}
 
+	// Optional prompt template, used instead of a free-form prompt
+	var templateID int64
+	if templateIDStr := r.FormValue("template_id"); templateIDStr != "" {
+		id, err := strconv.ParseInt(templateIDStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid template_id: %v", err))
+			return
+		}
+		templateID = id
+	}
+
 	// Get the user from the context
 	user := app.contextGetUser(r)
 	if user.Id == 0 {
@@ -389,6 +498,7 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 	}
 
 	// If folder ID is provided, verify that it exists and belongs to the user
+	var folderName string
 	if folderID != nil && *folderID != 0 {
 		folder, err := app.models.Folders.Get(*folderID)
 		if err != nil {
@@ -406,15 +516,42 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 			app.notPermittedResponse(w, r)
 			return
 		}
+
+		folderName = folder.Name
 	}
 
-	// Validate title
+	// Use the requested pipeline, or the user's preferred one
+	pipeline := app.notePipeline(user, r.FormValue("pipeline"))
+
+	// Optional language of the audio, detected when left out, and of the
+	// summary, which otherwise follows the audio. "language" is the older
+	// name of summary_language.
+	summaryLanguage := r.FormValue("summary_language")
+	if summaryLanguage == "" {
+		summaryLanguage = r.FormValue("language")
+	}
+
+	// Validate title, pipeline, languages and prompt
 	v := validator.New()
-	if data.ValidateTitle(v, title); !v.Valid() {
+	data.ValidateTitle(v, title)
+	app.validatePipeline(v, pipeline)
+	languages := app.readNoteLanguages(v, pipeline, r.FormValue("transcript_language"), summaryLanguage)
+	v.Check(prompt == "" || templateID == 0, "prompt", "must not be given together with template_id")
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// Look up the template now; it's filled in once the note exists
+	var template *data.PromptTemplate
+	if templateID != 0 {
+		var ok bool
+		template, ok = app.readPromptTemplate(w, r, user, templateID)
+		if !ok {
+			return
+		}
+	}
+
 	// Get the audio file from the form data
 	file, header, err := r.FormFile("audio")
 	if err != nil {
@@ -425,29 +562,81 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 
 	// Validate file type
 	fileExt := filepath.Ext(header.Filename)
-	if fileExt != ".mp3" && fileExt != ".wav" && fileExt != ".m4a" && fileExt != ".ogg" {
+	if !slices.Contains(audioExtensions, fileExt) {
 		app.badRequestResponse(w, r, errors.New("invalid audio file format"))
 		return
 	}
 
-	// Create uploads directory for this user
-	uploadsDir := filepath.Join(".", "uploads", strconv.FormatInt(user.Id, 10))
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+	// Store the audio under the user's uploads directory
+	filePath, err := app.saveAudioFile(user.Id, title, fileExt, file)
+	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Sanitize the title for use in the filename
-	// Replace problematic characters (like /, :, spaces) with underscores
-	sanitizedTitle := strings.ReplaceAll(title, " ", "_")
-	// Use a regex to remove any characters that are not alphanumeric, underscore, or hyphen
-	reg, err := regexp.Compile("[^a-zA-Z0-9_-]+")
-	if err == nil { // Only proceed if regex compilation is successful
-		sanitizedTitle = reg.ReplaceAllString(sanitizedTitle, "")
-	} else {
+	// Create a new note in the database
+	note := &data.Note{
+		Title:         title,
+		AudioFilePath: filePath,
+		UserID:        user.Id,
+		FolderID:      folderID,
+	}
+
+	// Insert the note in the database
+	err = app.models.Notes.Insert(note)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		// Clean up the file if database insertion failed
+		os.Remove(filePath)
+		return
+	}
+
+	// Fill in the template for this note
+	if template != nil {
+		prompt = renderPromptTemplate(template, note, folderName, languages)
+	}
+
+	// Queue the audio for processing. The job survives restarts and is retried
+	// with backoff if the transcription or embeddings provider fails.
+	_, err = app.models.Jobs.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{
+		NoteID:             note.ID,
+		Prompt:             prompt,
+		TranscriptLanguage: languages.Transcript,
+		SummaryLanguage:    languages.Summary,
+		Pipeline:           pipeline,
+	}, app.config.jobs.maxAttempts)
+	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		// Clean up the note and file if the job could not be queued
+		app.models.Notes.Delete(note.ID)
+		os.Remove(filePath)
 		return
 	}
+
+	// Return the newly created note
+	err = app.writeJSON(w, http.StatusAccepted, envelope{
+		"note":    note,
+		"message": "Audio file uploaded successfully. Processing has started in the background.",
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// saveAudioFile copies an uploaded audio file into the user's uploads
+// directory under a unique name derived from the title, and returns its path
+func (app *application) saveAudioFile(userID int64, title, fileExt string, src io.Reader) (string, error) {
+	// Create uploads directory for this user
+	uploadsDir := filepath.Join(".", "uploads", strconv.FormatInt(userID, 10))
+	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
+		return "", err
+	}
+
+	// Sanitize the title for use in the filename
+	// Replace problematic characters (like /, :, spaces) with underscores
+	sanitizedTitle := strings.ReplaceAll(title, " ", "_")
+	// Remove any characters that are not alphanumeric, underscore, or hyphen
+	sanitizedTitle = unsafeFilenameChars.ReplaceAllString(sanitizedTitle, "")
 	// Limit the length of the sanitized title to avoid overly long filenames
 	maxTitleLength := 50
 	if len(sanitizedTitle) > maxTitleLength {
@@ -461,114 +650,378 @@ func (app *application) processAudioWithGeminiHandler(w http.ResponseWriter, r *
 	// Create the file
 	dst, err := os.Create(filePath)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		return "", err
 	}
 	defer dst.Close()
 
 	// Copy the uploaded file to the created file
-	if _, err := io.Copy(dst, file); err != nil {
-		app.serverErrorResponse(w, r, err)
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
+
+	return filePath, nil
+}
+
+// reprocessNoteHandler runs the processing pipeline again on a note's stored
+// audio, or only regenerates its summary from the existing transcript. The
+// client must send the version it last saw, in If-Match or the body, so it
+// doesn't overwrite edits it hasn't seen.
+func (app *application) reprocessNoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	// Create a new note in the database
-	note := &data.Note{
-		Title:         title,
-		AudioFilePath: filePath,
-		UserID:        user.Id,
-		FolderID:      folderID,
+	expectedVersion, hasVersion, err := app.readIfMatch(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
-	// Insert the note in the database
-	err = app.models.Notes.Insert(note)
+	var input struct {
+		Prompt             string `json:"prompt"`
+		TemplateID         *int64 `json:"template_id"`
+		TranscriptLanguage string `json:"transcript_language"`
+		SummaryLanguage    string `json:"summary_language"`
+		Language           string `json:"language"`
+		Pipeline           string `json:"pipeline"`
+		SummaryOnly        bool   `json:"summary_only"`
+		Version            *int   `json:"version"`
+	}
+
+	err = app.ReadJSON(w, r, &input)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		// Clean up the file if database insertion failed
-		os.Remove(filePath)
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	// Process the audio file with Gemini in a background goroutine
-	app.background(func() {
-		// Process audio with Gemini
-		result, err := app.geminiService.ProcessAudioFile(filePath, prompt)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{
-				"note_id": fmt.Sprintf("%d", note.ID),
-				"process": "gemini_audio_processing",
-			})
-			return
-		}
+	// language is the older name of summary_language
+	if input.SummaryLanguage == "" {
+		input.SummaryLanguage = input.Language
+	}
 
-		// Parse the result to separate transcript and summary
-		parts := strings.Split(result, "##**##")
-		var transcript, summary string
-		if len(parts) == 2 {
-			transcript = strings.TrimSpace(parts[0])
-			summary = strings.TrimSpace(parts[1])
-		} else {
-			// If the separator isn't found, use the whole result as transcript
-			transcript = result
-			summary = result
-			app.logger.PrintInfo("Separator not found in Gemini response", map[string]string{
-				"note_id": fmt.Sprintf("%d", note.ID),
-			})
-		}
+	if input.Version != nil {
+		expectedVersion, hasVersion = *input.Version, true
+	}
 
-		// Update the note with transcript from Gemini
-		note.Transcript = sql.NullString{String: transcript, Valid: transcript != ""} // Assign as sql.NullString
-		err = app.models.Notes.UpdateTranscript(note)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{
-				"note_id": fmt.Sprintf("%d", note.ID),
-				"process": "update_transcript",
-			})
-			return
+	v := validator.New()
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	if !hasVersion {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+
+	// Use the requested pipeline, or the user's preferred one
+	pipeline := app.notePipeline(user, input.Pipeline)
+	app.validatePipeline(v, pipeline)
+	languages := app.readNoteLanguages(v, pipeline, input.TranscriptLanguage, input.SummaryLanguage)
+	v.Check(input.Prompt == "" || input.TemplateID == nil, "prompt", "must not be given together with template_id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
 		}
+		return
+	}
 
-		// Update with summary
-		note.Summary = sql.NullString{String: summary, Valid: summary != ""} // Assign as sql.NullString
-		err = app.models.Notes.UpdateSummary(note)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{
-				"note_id": fmt.Sprintf("%d", note.ID),
-				"process": "update_summary",
-			})
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	// Reject the request if the client is working from a stale copy of the note
+	if expectedVersion != note.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	// Don't start a second run while another is still queued or running
+	pending, err := app.models.Jobs.HasPendingForNote(note.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if pending {
+		app.conflictResponse(w, r)
+		return
+	}
+
+	// Fill in the template for this note
+	if input.TemplateID != nil {
+		template, ok := app.readPromptTemplate(w, r, user, *input.TemplateID)
+		if !ok {
 			return
 		}
 
-		// Generate and store embeddings for the transcript
-		var folderIDValue int64
+		var folderName string
 		if note.FolderID != nil {
-			folderIDValue = *note.FolderID
+			folder, err := app.models.Folders.Get(*note.FolderID)
+			if err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if folder != nil {
+				folderName = folder.Name
+			}
 		}
 
-		err = app.models.Embeddings.ProcessAndStoreEmbeddings(transcript, note.ID, folderIDValue, app.ai)
-		if err != nil {
-			app.logger.PrintError(err, map[string]string{
-				"note_id": fmt.Sprintf("%d", note.ID),
-				"process": "generate_embeddings",
-			})
-			return
+		input.Prompt = renderPromptTemplate(template, note, folderName, languages)
+	}
+
+	if input.SummaryOnly {
+		v.Check(note.Transcript.Valid, "summary_only", "note has no transcript to summarize")
+	} else if _, err := os.Stat(note.AudioFilePath); err != nil {
+		v.AddError("audio", "the note's audio file is no longer available")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The status is reset together with queueing, so a refused run leaves the
+	// note as it is
+	if input.SummaryOnly {
+		_, err = app.models.Jobs.EnqueueNoteRun(note, data.JobKindRegenerateSummary, data.RegenerateSummaryPayload{
+			NoteID:          note.ID,
+			Prompt:          input.Prompt,
+			SummaryLanguage: languages.Summary,
+			Pipeline:        pipeline,
+		}, app.config.jobs.maxAttempts)
+	} else {
+		_, err = app.models.Jobs.EnqueueNoteRun(note, data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{
+			NoteID:             note.ID,
+			Prompt:             input.Prompt,
+			TranscriptLanguage: languages.Transcript,
+			SummaryLanguage:    languages.Summary,
+			Pipeline:           pipeline,
+			Reprocess:          true,
+		}, app.config.jobs.maxAttempts)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateJob):
+			// Another request queued a run since the check above
+			app.conflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
 		}
+		return
+	}
 
-		app.logger.PrintInfo("successfully processed audio with Gemini and stored embeddings", map[string]string{
-			"note_id": fmt.Sprintf("%d", note.ID),
-		})
-	})
+	app.events.Publish(noteStatusEvent(note))
 
-	// Return the newly created note
 	err = app.writeJSON(w, http.StatusAccepted, envelope{
 		"note":    note,
-		"message": "Audio file uploaded successfully. Processing has started in the background.",
+		"message": "Reprocessing has started in the background.",
 	}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-// testGeminiHandler processes an audio file with Gemini without authentication (for testing)
+// notePipeline returns the name of the pipeline to process a user's note with:
+// the requested one, else the user's preference while it is still configured,
+// else the default
+func (app *application) notePipeline(user *data.User, requested string) string {
+	if requested != "" {
+		return requested
+	}
+
+	if _, err := app.ai.Pipeline(user.Pipeline); err == nil {
+		return user.Pipeline
+	}
+
+	return ""
+}
+
+// validatePipeline checks that name is empty or one of the configured pipelines
+func (app *application) validatePipeline(v *validator.Validator, name string) {
+	names := app.ai.PipelineNames()
+	v.Check(name == "" || validator.In(name, names...), "pipeline", fmt.Sprintf("must be one of %s", strings.Join(names, ", ")))
+}
+
+// processNoteAudio transcribes the note's audio, stores its timed segments and
+// spoken language, summarizes it unless the transcriber already did, and
+// stores the embeddings of the transcript, recording each stage on the note.
+// The new content is saved as a revision, made by the transcription provider
+// that ran unless the note is being reprocessed.
+func (app *application) processNoteAudio(ctx context.Context, note *data.Note, pipeline *ai.Pipeline, prompt string, languages noteLanguages, reprocess bool) error {
+	app.setNoteStatus(note, data.NoteStatusTranscribing, nil)
+
+	result, err := pipeline.Transcriber.Transcribe(ctx, ai.TranscriptionRequest{
+		AudioFilePath:      note.AudioFilePath,
+		Prompt:             prompt,
+		TranscriptLanguage: languages.Transcript,
+		SummaryLanguage:    languages.Summary,
+	})
+	if err != nil {
+		return fmt.Errorf("%s transcription: %w", pipeline.Transcriber.Name(), err)
+	}
+	transcript := result.Transcript
+
+	source := result.Provider
+	if source == "" {
+		source = pipeline.Transcriber.Name()
+	}
+	if reprocess {
+		source = data.RevisionSourceReprocess
+	}
+
+	// The language the user gave, else the one the provider detected
+	language := languages.Transcript
+	if language == "" {
+		language, _ = ai.ParseLanguage(result.Language)
+	}
+
+	// Update the note with the transcript
+	previous := note.Content()
+	note.Transcript = sql.NullString{String: transcript, Valid: transcript != ""}
+	note.Language = nil
+	if language != "" {
+		note.Language = &language
+	}
+	err = app.models.Notes.UpdateTranscript(note, previous)
+	if err != nil {
+		return fmt.Errorf("update transcript: %w", err)
+	}
+	app.publishNoteEvent(note, events.TypeTranscript, envelope{"transcript": transcript})
+
+	// Replace the segments of any earlier transcription, even with none
+	segments := make([]*data.TranscriptSegment, 0, len(result.Segments))
+	for _, segment := range result.Segments {
+		segments = append(segments, &data.TranscriptSegment{
+			Start:   segment.Start,
+			End:     segment.End,
+			Speaker: segment.Speaker,
+			Text:    segment.Text,
+		})
+	}
+	err = app.models.Segments.ReplaceForNote(note.ID, segments)
+	if err != nil {
+		return fmt.Errorf("update segments: %w", err)
+	}
+
+	app.setNoteStatus(note, data.NoteStatusSummarizing, nil)
+
+	// Transcribers that don't summarize leave it to the chat model
+	summary := result.Summary
+	if summary == "" && transcript != "" {
+		summary, err = ai.Summarize(ctx, pipeline.Summarizer, transcript, prompt, languages.Summary)
+		if err != nil {
+			return fmt.Errorf("%s summarization: %w", pipeline.Summarizer.Name(), err)
+		}
+	}
+
+	// Update with summary
+	previous = note.Content()
+	note.Summary = sql.NullString{String: summary, Valid: summary != ""}
+	err = app.models.Notes.UpdateSummary(note, previous)
+	if err != nil {
+		return fmt.Errorf("update summary: %w", err)
+	}
+	app.publishNoteEvent(note, events.TypeSummary, envelope{"summary": summary})
+
+	app.recordRevision(note, source, nil)
+
+	err = app.embedNoteTranscript(ctx, note)
+	if err != nil {
+		return err
+	}
+
+	app.setNoteStatus(note, data.NoteStatusReady, nil)
+
+	app.logger.PrintInfo("successfully processed audio and stored embeddings", map[string]string{
+		"note_id": fmt.Sprintf("%d", note.ID),
+	})
+
+	return nil
+}
+
+// embedNoteTranscript replaces the embeddings of the note with fresh ones
+// generated from its current transcript
+func (app *application) embedNoteTranscript(ctx context.Context, note *data.Note) error {
+	app.setNoteStatus(note, data.NoteStatusEmbedding, nil)
+
+	// Segments let the chunks be placed in the audio
+	segments, err := app.models.Segments.GetForNote(note.ID)
+	if err != nil {
+		return fmt.Errorf("get segments: %w", err)
+	}
+
+	// Generate and store embeddings for the transcript
+	err = app.models.Embeddings.ProcessAndStoreEmbeddings(ctx, note.Transcript.String, segments, note.ID, note.UserID, note.FolderID, app.ai.Embedder)
+	if err != nil {
+		return fmt.Errorf("generate embeddings: %w", err)
+	}
+
+	return nil
+}
+
+// regenerateNoteSummary summarizes the note's existing transcript again without
+// touching the transcript or its embeddings
+func (app *application) regenerateNoteSummary(ctx context.Context, note *data.Note, pipeline *ai.Pipeline, prompt, language string) error {
+	if !note.Transcript.Valid {
+		return errors.New("note has no transcript to summarize")
+	}
+
+	app.setNoteStatus(note, data.NoteStatusSummarizing, nil)
+
+	summary, err := ai.Summarize(ctx, pipeline.Summarizer, note.Transcript.String, prompt, language)
+	if err != nil {
+		return fmt.Errorf("%s summarization: %w", pipeline.Summarizer.Name(), err)
+	}
+
+	previous := note.Content()
+	note.Summary = sql.NullString{String: summary, Valid: summary != ""}
+	err = app.models.Notes.UpdateSummary(note, previous)
+	if err != nil {
+		return fmt.Errorf("update summary: %w", err)
+	}
+	app.publishNoteEvent(note, events.TypeSummary, envelope{"summary": summary})
+
+	app.recordRevision(note, data.RevisionSourceReprocess, nil)
+
+	app.setNoteStatus(note, data.NoteStatusReady, nil)
+
+	return nil
+}
+
+// setNoteStatus records a processing stage on the note. Failing to record it is
+// logged rather than returned so it never aborts the pipeline itself.
+func (app *application) setNoteStatus(note *data.Note, status string, statusErr error) {
+	err := app.models.Notes.UpdateStatus(note, status, statusErr)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"note_id": fmt.Sprintf("%d", note.ID),
+			"status":  status,
+			"process": "update_note_status",
+		})
+		return
+	}
+
+	app.events.Publish(noteStatusEvent(note))
+}
+
+// testGeminiHandler processes an audio file with the configured transcription
+// provider without authentication (for testing)
 func (app *application) testGeminiHandler(w http.ResponseWriter, r *http.Request) {
 	// Maximum file size: 100MB
 	const maxFileSize = 100 * 1024 * 1024
@@ -579,11 +1032,8 @@ func (app *application) testGeminiHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Get the prompt from the form data (optional with default)
+	// Get the optional prompt from the form data
 	prompt := r.FormValue("prompt")
-	if prompt == "" {
-		prompt = "Please transcribe this audio and provide a detailed summary of its content. Include key points and main topics."
-	}
 
 	// Get the audio file from the form data
 	file, header, err := r.FormFile("audio")
@@ -625,10 +1075,13 @@ func (app *application) testGeminiHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Process audio with Gemini
-	result, err := app.geminiService.ProcessAudioFile(filePath, prompt)
+	// Process audio with the transcription provider
+	result, err := app.ai.Transcriber.Transcribe(r.Context(), ai.TranscriptionRequest{
+		AudioFilePath: filePath,
+		Prompt:        prompt,
+	})
 	if err != nil {
-		app.serverErrorResponse(w, r, fmt.Errorf("gemini processing failed: %w", err))
+		app.serverErrorResponse(w, r, fmt.Errorf("%s processing failed: %w", app.ai.Transcriber.Name(), err))
 
 		// Clean up the temporary file
 		os.Remove(filePath)
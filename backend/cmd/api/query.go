@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/validator"
+	"github.com/pgvector/pgvector-go"
+)
+
+// queryNotesHandler answers a question over all of the user's notes, filed or
+// not. folder_ids and note_ids optionally narrow the notes that are searched;
+// include_descendants extends folder_ids to their subfolders.
+func (app *application) queryNotesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Query              string  `json:"query"`
+		FolderIDs          []int64 `json:"folder_ids"`
+		NoteIDs            []int64 `json:"note_ids"`
+		IncludeDescendants bool    `json:"include_descendants"`
+	}
+
+	err := app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Query != "", "query", "must be provided")
+	v.Check(len(input.FolderIDs) <= 100, "folder_ids", "must not contain more than 100 folders")
+	v.Check(len(input.NoteIDs) <= 100, "note_ids", "must not contain more than 100 notes")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Make sure every requested folder and note is one of the user's own
+	var folderIDs []int64
+	for _, id := range input.FolderIDs {
+		folder, err := app.models.Folders.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if folder.UserID != user.Id {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		if !input.IncludeDescendants {
+			folderIDs = append(folderIDs, id)
+			continue
+		}
+
+		subtree, err := app.models.Folders.GetSubtreeIDs(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		folderIDs = append(folderIDs, subtree...)
+	}
+
+	for _, id := range input.NoteIDs {
+		note, err := app.models.Notes.Get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if note.UserID != user.Id {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	app.answerQuery(w, r, input.Query, data.ChunkQuery{
+		UserID:    user.Id,
+		FolderIDs: folderIDs,
+		NoteIDs:   input.NoteIDs,
+	})
+}
+
+// answerQuery retrieves the chunks relevant to the question within the given
+// scope and asks the LLM to answer from them
+func (app *application) answerQuery(w http.ResponseWriter, r *http.Request, question string, scope data.ChunkQuery) {
+	relevantChunks, err := app.retrieveChunks(r.Context(), question, scope)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Ask the LLM to answer from the numbered sources
+	answer, err := app.ai.Chat.Complete(r.Context(), buildCitedPrompt(question, relevantChunks))
+	if err != nil {
+		app.serverErrorResponse(w, r, fmt.Errorf("failed to get answer from %s: %w", app.ai.Chat.Name(), err))
+		return
+	}
+
+	// Return the answer together with the sources it cites
+	err = app.writeJSON(w, http.StatusOK, envelope{"answer": answer, "sources": querySources(relevantChunks)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// streamAnswer is the Server-Sent Events variant of answerQuery. The answer is
+// forwarded as "token" events while it is generated, followed by a "done"
+// event with the full answer and its sources, or an "error" event.
+func (app *application) streamAnswer(w http.ResponseWriter, r *http.Request, question string, scope data.ChunkQuery) {
+	// Retrieval happens before the stream starts so its failures are still
+	// reported as ordinary error responses
+	relevantChunks, err := app.retrieveChunks(r.Context(), question, scope)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rc, err := app.startSSE(w)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	answer, err := app.ai.Chat.Stream(r.Context(), buildCitedPrompt(question, relevantChunks), func(text string) error {
+		if err := app.writeSSE(w, "token", envelope{"text": text}); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil {
+		// The client is gone when its context is done; there is nobody to tell
+		if r.Context().Err() != nil {
+			return
+		}
+
+		app.logError(r, err)
+		app.writeSSE(w, "error", envelope{"error": "the answer could not be generated"})
+		rc.Flush()
+		return
+	}
+
+	err = app.writeSSE(w, "done", envelope{"answer": answer, "sources": querySources(relevantChunks)})
+	if err == nil {
+		err = rc.Flush()
+	}
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// retrieveChunks embeds the search text and runs hybrid retrieval within the
+// given scope. The text, embedding and limits of scope are filled in here;
+// ctx is the request's, so the embedding call stops when the client leaves.
+func (app *application) retrieveChunks(ctx context.Context, searchText string, scope data.ChunkQuery) ([]*data.RetrievedChunk, error) {
+	// Generate embedding for the query
+	queryEmbeddingFloat, err := app.ai.Embedder.Embed(ctx, searchText)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+
+	scope.Text = searchText
+	scope.Embedding = pgvector.NewVector(queryEmbeddingFloat)
+	scope.TopK = app.config.rag.topK
+	scope.Candidates = app.config.rag.candidates
+	scope.MinScore = app.config.rag.minScore
+
+	// Get relevant chunks by fusing semantic and keyword matches
+	relevantChunks, err := app.models.Embeddings.HybridSearch(scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve relevant chunks: %w", err)
+	}
+
+	return relevantChunks, nil
+}
+
+// querySource is a retrieved chunk as returned to the client. Index is the
+// number the answer uses to cite it, e.g. [2]. The offsets, when set, let the
+// client play the cited part of the note's audio; Language marks text taken
+// from a translation of the note.
+type querySource struct {
+	Index        int      `json:"index"`
+	NoteID       int64    `json:"note_id"`
+	NoteTitle    string   `json:"note_title"`
+	Text         string   `json:"text"`
+	Language     *string  `json:"language,omitempty"`
+	StartSeconds *float64 `json:"start_seconds,omitempty"`
+	EndSeconds   *float64 `json:"end_seconds,omitempty"`
+	Score        float64  `json:"score"`
+	Similarity   float64  `json:"similarity"`
+}
+
+// querySources numbers the chunks from 1 in the order they were given to the LLM
+func querySources(chunks []*data.RetrievedChunk) []querySource {
+	sources := make([]querySource, 0, len(chunks))
+	for i, chunk := range chunks {
+		sources = append(sources, querySource{
+			Index:        i + 1,
+			NoteID:       chunk.NoteID,
+			NoteTitle:    chunk.NoteTitle,
+			Text:         chunk.Text,
+			Language:     chunk.Language,
+			StartSeconds: chunk.StartSeconds,
+			EndSeconds:   chunk.EndSeconds,
+			Score:        chunk.Score,
+			Similarity:   chunk.Similarity,
+		})
+	}
+
+	return sources
+}
+
+// buildCitedPrompt lists the chunks as numbered sources and asks the LLM to
+// cite them inline by number
+func buildCitedPrompt(question string, chunks []*data.RetrievedChunk) string {
+	var sb strings.Builder
+
+	writeCitationInstructions(&sb, chunks)
+	fmt.Fprintf(&sb, "\nQuestion: %s", question)
+
+	return sb.String()
+}
+
+// writeCitationInstructions writes the answering rules followed by the
+// numbered sources
+func writeCitationInstructions(sb *strings.Builder, chunks []*data.RetrievedChunk) {
+	sb.WriteString("Answer the question using only the numbered sources below. ")
+	sb.WriteString("After every claim, cite the source it comes from by its number in square brackets, for example [1] or [2][3]. ")
+	sb.WriteString("Do not cite sources that are not listed. ")
+	sb.WriteString("If the information is not present in the sources, say so.\n\n")
+	sb.WriteString("Sources:\n")
+
+	for i, chunk := range chunks {
+		fmt.Fprintf(sb, "[%d] (from note %q) %s\n", i+1, chunk.NoteTitle, chunk.Text)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/diff"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// listNoteRevisionsHandler returns the revision history of a note, newest first
+func (app *application) listNoteRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+	qs := r.URL.Query()
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAllForNote(note.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getNoteRevisionHandler returns a single revision of a note
+func (app *application) getNoteRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.readIntParam(r, "rev")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	rev, err := app.models.Revisions.Get(note.ID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": rev}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffNoteRevisionsHandler returns the word-level changes between a revision
+// and an older one, by default the revision just before it
+func (app *application) diffNoteRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.readIntParam(r, "rev")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	against := app.readInt(r.URL.Query(), "against", revision-1, v)
+	v.Check(against >= 0, "against", "must not be negative")
+	v.Check(against != revision, "against", "must be a different revision")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	to, err := app.models.Revisions.Get(note.ID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Revision 0 stands for the empty note before its first revision
+	from := &data.NoteRevision{NoteID: note.ID}
+	if against > 0 {
+		from, err = app.models.Revisions.Get(note.ID, against)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"from":       from.Revision,
+		"to":         to.Revision,
+		"title":      diff.Words(from.Title, to.Title),
+		"transcript": diff.Words(from.Transcript.String, to.Transcript.String),
+		"summary":    diff.Words(from.Summary.String, to.Summary.String),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreNoteRevisionHandler copies an older revision's content back onto the
+// note and records the result as a new revision. Like an edit, it requires
+// the note's ETag in If-Match.
+func (app *application) restoreNoteRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.readIntParam(r, "rev")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	expectedVersion, hasVersion, err := app.readIfMatch(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	if !hasVersion {
+		app.preconditionRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if expectedVersion != note.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	rev, err := app.models.Revisions.Get(note.ID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	transcriptChanged := !sameText(rev.Transcript, note.Transcript)
+
+	note.Title = rev.Title
+	note.Transcript = rev.Transcript
+	note.Summary = rev.Summary
+
+	err = app.models.Notes.Update(note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.recordRevision(note, data.RevisionSourceRestore, &user.Id)
+
+	if transcriptChanged {
+		_, err = app.models.Jobs.Enqueue(data.JobKindEmbedNote, data.EmbedNotePayload{NoteID: note.ID}, app.config.jobs.maxAttempts)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(note.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recordRevision snapshots the note's current content. userID is nil for
+// changes made by the processing pipeline. Failures are logged so they never
+// undo a change that has already been saved.
+func (app *application) recordRevision(note *data.Note, source string, userID *int64) {
+	_, err := app.models.Revisions.Insert(note, source, userID)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"note_id": fmt.Sprintf("%d", note.ID),
+			"source":  source,
+			"process": "record_revision",
+		})
+	}
+}
+
+// sameText reports whether two nullable texts hold the same content
+func sameText(a, b sql.NullString) bool {
+	return a.String == b.String
+}
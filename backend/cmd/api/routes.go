@@ -18,6 +18,17 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.showCurrentUserHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.updateCurrentUserHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.deleteCurrentUserHandler)
+
+	// Exports of everything stored about the user
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/export", app.requestUserExportHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/exports/:id", app.getUserExportHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/exports/:id/download", app.downloadUserExportHandler)
+
+	// Folder archives being imported
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/imports/:id", app.getFolderImportHandler)
 
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
@@ -28,7 +39,31 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPost, "/v1/notes", app.createNoteHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/notes", app.listNotesHandler)
 	router.HandlerFunc(http.MethodGet, "/v1/notes/:id", app.getNoteHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/notes/:id", app.updateNoteHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id", app.deleteNoteHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/reprocess", app.reprocessNoteHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/segments", app.listNoteSegmentsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/export", app.exportNoteHandler)
+
+	// Note translations
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/translations", app.createNoteTranslationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/translations", app.listNoteTranslationsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/translations/:language", app.getNoteTranslationHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/notes/:id/translations/:language", app.deleteNoteTranslationHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/translations/:language/export", app.exportNoteTranslationHandler)
+
+	// Note revision history
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/revisions", app.listNoteRevisionsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/revisions/:rev", app.getNoteRevisionHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/revisions/:rev/diff", app.diffNoteRevisionsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/revisions/:rev/restore", app.restoreNoteRevisionHandler)
+
+	// Live note processing events (Server-Sent Events)
+	router.HandlerFunc(http.MethodGet, "/v1/notes/:id/events", app.noteEventsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/events", app.userEventsHandler)
+
+	// Languages each processing pipeline supports
+	router.HandlerFunc(http.MethodGet, "/v1/languages", app.listLanguagesHandler)
 
 	// New Gemini direct processing endpoint
 	router.HandlerFunc(http.MethodPost, "/v1/process/notes/gemini", app.processAudioWithGeminiHandler)
@@ -40,11 +75,41 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodPut, "/v1/folders/:id", app.updateFolderHandler)
 	router.HandlerFunc(http.MethodDelete, "/v1/folders/:id", app.deleteFolderHandler)
 
+	// Folder archives. POST /v1/folders/import is matched by the :id route.
+	router.HandlerFunc(http.MethodGet, "/v1/folders/:id/archive", app.folderArchiveHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/folders/:id", app.importFolderHandler)
+
+	// Full-text search
+	router.HandlerFunc(http.MethodGet, "/v1/search", app.searchNotesHandler)
+
+	// Trash
+	router.HandlerFunc(http.MethodGet, "/v1/trash", app.listTrashHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/notes/:id/restore", app.restoreNoteHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/folders/:id/restore", app.restoreFolderHandler)
+
 	// Note movement endpoint
 	router.HandlerFunc(http.MethodPut, "/v1/notes/:id/move", app.moveNoteHandler)
 
 	// Folder query endpoint
 	router.HandlerFunc(http.MethodPost, "/v1/folders/:id/query", app.queryFolderHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/folders/:id/query/stream", app.streamQueryFolderHandler)
+
+	// Query across all of the user's notes
+	router.HandlerFunc(http.MethodPost, "/v1/query", app.queryNotesHandler)
+
+	// Multi-turn chat sessions
+	router.HandlerFunc(http.MethodPost, "/v1/chats", app.createChatHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/chats", app.listChatsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/chats/:id", app.getChatHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/chats/:id", app.deleteChatHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/chats/:id/messages", app.sendChatMessageHandler)
+
+	// Prompt templates for summaries
+	router.HandlerFunc(http.MethodPost, "/v1/prompt-templates", app.createPromptTemplateHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/prompt-templates", app.listPromptTemplatesHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/prompt-templates/:id", app.getPromptTemplateHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/prompt-templates/:id", app.updatePromptTemplateHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/prompt-templates/:id", app.deletePromptTemplateHandler)
 
 	// Test endpoints
 	router.HandlerFunc(http.MethodPost, "/v1/test/gemini", app.testGeminiHandler)
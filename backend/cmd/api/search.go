@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// searchNotesHandler finds the user's notes containing the words in q
+func (app *application) searchNotesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.NoteSearch
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query = strings.TrimSpace(qs.Get("q"))
+	input.Status = app.readString(qs, "status", "")
+	input.From = app.readDate(qs, "from", v)
+	input.To = app.readDate(qs, "to", v)
+
+	if qs.Get("folder_id") != "" {
+		folderID := int64(app.readInt(qs, "folder_id", 0, v))
+		input.FolderID = &folderID
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-rank")
+	input.Filters.SortSafelist = []string{"rank", "created_at", "title", "-rank", "-created_at", "-title"}
+
+	data.ValidateNoteSearch(v, input.NoteSearch)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Verify the folder belongs to the user when searching a single folder
+	if input.FolderID != nil {
+		folder, err := app.models.Folders.Get(*input.FolderID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRcordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if folder.UserID != user.Id {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	results, metadata, err := app.models.Notes.Search(user.Id, input.NoteSearch, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+// listNoteSegmentsHandler returns the timed, speaker-labelled segments of a
+// note's transcript in playback order. matches_transcript is false once the
+// transcript has been edited since it was transcribed, in which case the
+// segments describe the audio rather than the current text.
+func (app *application) listNoteSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	segments, err := app.models.Segments.GetForNote(note.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"segments":           segments,
+		"matches_transcript": data.SegmentsMatchTranscript(note.Transcript.String, segments),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
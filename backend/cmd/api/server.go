@@ -11,6 +11,10 @@ import (
 	"time"
 )
 
+// shutdownTimeout bounds how long in-flight requests, and then the job
+// workers, get to finish once a signal arrives
+const shutdownTimeout = 5 * time.Second
+
 func (app *application) serve() error {
 	srv := &http.Server{
 		Addr:        fmt.Sprintf(":%d", app.config.port),
@@ -22,6 +26,13 @@ func (app *application) serve() error {
 		WriteTimeout: 600 * time.Second,
 	}
 
+	// Event streams never finish on their own, so tell them to return as soon
+	// as Shutdown starts instead of letting them hold it until the timeout
+	app.shutdown = make(chan struct{})
+	srv.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -31,13 +42,26 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("shutting down server", map[string]string{
 			"signal": s.String(),
 		})
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			shutdownError <- err
 		}
 
+		app.logger.PrintInfo("draining job workers", map[string]string{
+			"addr": srv.Addr,
+		})
+
+		// Running jobs are cancelled and released for the next start
+		workersCtx, cancelWorkers := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelWorkers()
+
+		err = app.stopWorkers(workersCtx)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"addr": srv.Addr})
+		}
+
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
@@ -46,6 +70,8 @@ func (app *application) serve() error {
 		shutdownError <- nil
 	}()
 
+	app.startWorkers()
+
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
 		"env":  app.config.env,
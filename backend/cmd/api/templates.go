@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/m0hh/Notes/internal/ai"
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// createPromptTemplateHandler saves a prompt template for the user
+func (app *application) createPromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Body        string `json:"body"`
+	}
+
+	err := app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template := &data.PromptTemplate{
+		UserID:      &user.Id,
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Body:        strings.TrimSpace(input.Body),
+	}
+
+	v := validator.New()
+	if data.ValidatePromptTemplate(v, template); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Templates.Insert(template)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/prompt-templates/%d", template.ID))
+	headers.Set("ETag", versionETag(template.Version))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"template": template}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listPromptTemplatesHandler returns the built-in templates and the user's own
+func (app *application) listPromptTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	templates, err := app.models.Templates.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"templates": templates,
+		"variables": ai.PromptVariables,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getPromptTemplateHandler returns a built-in template or one of the user's
+func (app *application) getPromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readUserPromptTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(template.Version))
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"template": template}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updatePromptTemplateHandler changes one of the user's templates. Built-in
+// templates can't be changed. A stale ETag in If-Match is rejected.
+func (app *application) updatePromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	expectedVersion, hasVersion, err := app.readIfMatch(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template, ok := app.readUserPromptTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if template.Builtin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if hasVersion && expectedVersion != template.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Body        *string `json:"body"`
+	}
+
+	err = app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		template.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		template.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Body != nil {
+		template.Body = strings.TrimSpace(*input.Body)
+	}
+
+	v := validator.New()
+	if data.ValidatePromptTemplate(v, template); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Templates.Update(template)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(template.Version))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"template": template}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deletePromptTemplateHandler removes one of the user's templates
+func (app *application) deletePromptTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readUserPromptTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if template.Builtin {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Templates.Delete(template.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readUserPromptTemplate looks up the template in the URL and checks that the
+// authenticated user can use it. It writes the error response itself and
+// reports whether the caller should carry on.
+func (app *application) readUserPromptTemplate(w http.ResponseWriter, r *http.Request) (*data.PromptTemplate, bool) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Get the user from context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return nil, false
+	}
+
+	return app.readPromptTemplate(w, r, user, id)
+}
+
+// readPromptTemplate gets a template the user can summarize with: a built-in
+// one or one of their own. It writes the error response itself and reports
+// whether the caller should carry on.
+func (app *application) readPromptTemplate(w http.ResponseWriter, r *http.Request, user *data.User, id int64) (*data.PromptTemplate, bool) {
+	template, err := app.models.Templates.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !template.UsableBy(user.Id) {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return template, true
+}
+
+// renderPromptTemplate fills in a template for the note in the folder with the
+// given name, processed in the given languages. The date is the day the note
+// was created, so reprocessing it later doesn't change it.
+func renderPromptTemplate(template *data.PromptTemplate, note *data.Note, folder string, languages noteLanguages) string {
+	language := "the language spoken in the recording"
+	if languages.Summary != "" {
+		language = ai.LanguageName(languages.Summary)
+	}
+
+	transcriptLanguage := "the language spoken in the recording"
+	if languages.Transcript != "" {
+		transcriptLanguage = ai.LanguageName(languages.Transcript)
+	}
+
+	return ai.RenderPrompt(template.Body, map[string]string{
+		"title":               note.Title,
+		"folder":              folder,
+		"language":            language,
+		"transcript_language": transcriptLanguage,
+		"date":                note.CreatedAt.Format("2006-01-02"),
+	})
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/m0hh/Notes/internal/ai"
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/export"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// translationFormats are the export formats a translation can be downloaded
+// in. Captions need timed segments, which translations don't have.
+var translationFormats = []string{export.FormatMarkdown, export.FormatText, export.FormatJSON}
+
+// createNoteTranslationHandler queues a translation of the note's transcript
+// and summary into the requested language. Asking again for a language that
+// was already translated translates the current note over it.
+func (app *application) createNoteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Language string `json:"language"`
+		Embed    bool   `json:"embed"`
+		Pipeline string `json:"pipeline"`
+	}
+
+	err = app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	// Use the requested pipeline, or the user's preferred one. Its chat
+	// model does the translating.
+	pipeline := app.notePipeline(user, input.Pipeline)
+
+	v := validator.New()
+	v.Check(input.Language != "", "language", "must be provided")
+	app.validatePipeline(v, pipeline)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	selected, err := app.ai.Pipeline(pipeline)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The chat model has to be able to write the target language
+	language := validateLanguage(v, "language", input.Language, selected.Name, selected.SummaryLanguages())
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v.Check(note.Transcript.Valid, "note", "has no transcript to translate yet")
+	if note.Language != nil {
+		v.Check(ai.BaseLanguage(*note.Language) != ai.BaseLanguage(language), "language", "must differ from the language of the note")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	translation := &data.NoteTranslation{
+		NoteID:        note.ID,
+		Language:      language,
+		Embed:         input.Embed,
+		SourceVersion: note.Version,
+	}
+
+	err = app.models.Translations.Request(translation)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	_, err = app.models.Jobs.Enqueue(data.JobKindTranslateNote, data.TranslateNotePayload{
+		TranslationID: translation.ID,
+		Pipeline:      pipeline,
+	}, app.config.jobs.maxAttempts)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/notes/%d/translations/%s", note.ID, translation.Language))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"translation": translation}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listNoteTranslationsHandler returns the note's translations without their
+// text. Translations made from an older version of the note are marked stale.
+func (app *application) listNoteTranslationsHandler(w http.ResponseWriter, r *http.Request) {
+	note, ok := app.readTranslatedNote(w, r)
+	if !ok {
+		return
+	}
+
+	translations, err := app.models.Translations.GetAllForNote(note.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type translationSummary struct {
+		*data.NoteTranslation
+		Stale bool `json:"stale"`
+	}
+
+	list := make([]translationSummary, 0, len(translations))
+	for _, translation := range translations {
+		list = append(list, translationSummary{translation, translation.SourceVersion != note.Version})
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"translations": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getNoteTranslationHandler returns a translation with its text
+func (app *application) getNoteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	note, translation, ok := app.readNoteTranslation(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{
+		"translation": translation,
+		"stale":       translation.SourceVersion != note.Version,
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportNoteTranslationHandler downloads a ready translation as Markdown,
+// plain text or JSON, chosen with the format query parameter
+func (app *application) exportNoteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	format := app.readString(r.URL.Query(), "format", export.FormatMarkdown)
+
+	v := validator.New()
+	v.Check(validator.In(format, translationFormats...), "format", fmt.Sprintf("must be one of %s", strings.Join(translationFormats, ", ")))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	note, translation, ok := app.readNoteTranslation(w, r)
+	if !ok {
+		return
+	}
+
+	v.Check(translation.Status == data.TranslationStatusReady, "translation", "is not ready yet")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The translation is rendered as the note with its text swapped in
+	translated := *note
+	translated.Transcript.String = translation.Transcript
+	translated.Summary.String = translation.Summary
+	translated.Summary.Valid = translation.Summary != ""
+	translated.Language = &translation.Language
+
+	doc := export.Document{Note: &translated}
+
+	if note.FolderID != nil {
+		folder, err := app.models.Folders.Get(*note.FolderID)
+		if err != nil && !errors.Is(err, data.ErrRcordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if folder != nil {
+			doc.Folder = folder.Name
+		}
+	}
+
+	body, err := export.Render(format, doc)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	name := fmt.Sprintf("%s (%s)", note.Title, translation.Language)
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", export.ContentDisposition(name, format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// deleteNoteTranslationHandler removes a translation and its embeddings
+func (app *application) deleteNoteTranslationHandler(w http.ResponseWriter, r *http.Request) {
+	_, translation, ok := app.readNoteTranslation(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Translations.Delete(translation.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "translation successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTranslatedNote looks up the note in the URL and checks that it belongs
+// to the authenticated user. It writes the error response itself and reports
+// whether the caller should carry on.
+func (app *application) readTranslatedNote(w http.ResponseWriter, r *http.Request) (*data.Note, bool) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return nil, false
+	}
+
+	note, err := app.models.Notes.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return note, true
+}
+
+// readNoteTranslation looks up the note in the URL and its translation into
+// the language in the URL, in the same way as readTranslatedNote
+func (app *application) readNoteTranslation(w http.ResponseWriter, r *http.Request) (*data.Note, *data.NoteTranslation, bool) {
+	language, err := ai.ParseLanguage(httprouter.ParamsFromContext(r.Context()).ByName("language"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	note, ok := app.readTranslatedNote(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	translation, err := app.models.Translations.GetForNote(note.ID, language)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return note, translation, true
+}
+
+// translateNoteJob translates the note of the translation in the payload and
+// embeds the translated transcript when asked to
+func (app *application) translateNoteJob(ctx context.Context, job *data.Job) error {
+	var payload data.TranslateNotePayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	translation, err := app.models.Translations.Get(payload.TranslationID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			// The translation or its note was deleted while the job was waiting
+			return nil
+		default:
+			return err
+		}
+	}
+
+	note, err := app.models.Notes.Get(translation.NoteID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	err = app.translateNote(ctx, note, translation, payload.Pipeline)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			// The translation was requested again; the newer job takes over
+			return nil
+		case job.Attempts >= job.MaxAttempts && ctx.Err() == nil:
+			if err := app.models.Translations.MarkFailed(translation, err); err != nil && !errors.Is(err, data.ErrEditConflict) {
+				app.logger.PrintError(err, map[string]string{
+					"translation_id": fmt.Sprintf("%d", translation.ID),
+				})
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// translateNote translates the note's transcript and summary with the
+// pipeline's chat model, stores them and refreshes the translation's
+// embeddings
+func (app *application) translateNote(ctx context.Context, note *data.Note, translation *data.NoteTranslation, pipelineName string) error {
+	pipeline, err := app.ai.Pipeline(pipelineName)
+	if err != nil {
+		return err
+	}
+
+	if !note.Transcript.Valid {
+		return errors.New("note has no transcript to translate")
+	}
+
+	transcript, err := ai.Translate(ctx, pipeline.Summarizer, note.Transcript.String, translation.Language)
+	if err != nil {
+		return fmt.Errorf("%s translation: %w", pipeline.Summarizer.Name(), err)
+	}
+
+	var summary string
+	if note.Summary.Valid && note.Summary.String != "" {
+		summary, err = ai.Translate(ctx, pipeline.Summarizer, note.Summary.String, translation.Language)
+		if err != nil {
+			return fmt.Errorf("%s translation: %w", pipeline.Summarizer.Name(), err)
+		}
+	}
+
+	translation.Transcript = transcript
+	translation.Summary = summary
+
+	err = app.models.Translations.MarkReady(translation)
+	if err != nil {
+		return err
+	}
+
+	// Embeddings of an earlier run are dropped when embedding was turned off
+	if !translation.Embed {
+		return app.models.Embeddings.DeleteByTranslationID(translation.ID)
+	}
+
+	err = app.models.Embeddings.ProcessAndStoreTranslationEmbeddings(ctx, translation, note.UserID, note.FolderID, app.ai.Embedder)
+	if err != nil {
+		return fmt.Errorf("generate embeddings: %w", err)
+	}
+
+	return nil
+}
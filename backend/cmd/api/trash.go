@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+// listTrashHandler returns the notes and folders the user has deleted and
+// that have not been purged yet
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	folders, err := app.models.Folders.GetTrash(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	notes, err := app.models.Notes.GetTrash(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{
+		"folders":        folders,
+		"notes":          notes,
+		"retention_days": int(app.config.trash.retention / (24 * time.Hour)),
+	}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreNoteHandler takes a note out of the trash
+func (app *application) restoreNoteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	note, err := app.models.Notes.GetDeleted(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check if the note belongs to the user
+	if note.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Notes.Restore(note)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"note": note}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreFolderHandler takes a folder out of the trash together with the
+// folders and notes that were deleted with it
+func (app *application) restoreFolderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Get the user from the context
+	user := app.contextGetUser(r)
+	if user.Id == 0 {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+
+	folder, err := app.models.Folders.GetDeleted(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Ensure the folder belongs to this user
+	if folder.UserID != user.Id {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Folders.Restore(folder)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRcordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"folder": folder}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrashLoop periodically removes everything that has been in the trash
+// for longer than the retention period, and user exports that have expired
+func (app *application) purgeTrashLoop() {
+	defer app.jobsWG.Done()
+
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.jobsQuit:
+			return
+		case <-ticker.C:
+			app.purgeTrash()
+			app.purgeExpiredExports()
+		}
+	}
+}
+
+// purgeTrash deletes expired notes, their audio files and expired folders.
+// Each row is deleted by a single statement, so several replicas can purge
+// concurrently without removing a file twice.
+func (app *application) purgeTrash() {
+	paths, err := app.models.Notes.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"process": "purge_trash"})
+		return
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			app.logger.PrintError(err, map[string]string{
+				"process": "purge_trash",
+				"path":    path,
+			})
+		}
+	}
+
+	folders, err := app.models.Folders.PurgeDeleted(app.config.trash.retention)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"process": "purge_trash"})
+		return
+	}
+
+	if len(paths) > 0 || folders > 0 {
+		app.logger.PrintInfo("purged trash", map[string]string{
+			"notes":   fmt.Sprintf("%d", len(paths)),
+			"folders": fmt.Sprintf("%d", folders),
+		})
+	}
+}
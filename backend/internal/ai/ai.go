@@ -1,42 +1,62 @@
 package ai
 
 import (
-	"fmt"
+	"context"
 )
 
-// AIService provides a unified interface for AI services
-type AIService struct {
-	OpenAIAPIKey string
-	GeminiAPIKey string
+// Transcriber turns an audio file into text. Providers that can summarize the
+// audio in the same pass fill in Transcription.Summary; otherwise the caller
+// summarizes the transcript with a ChatModel.
+type Transcriber interface {
+	Name() string
+	Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcription, error)
 }
 
-// NewAIService creates a new AI service instance
-func NewAIService(openAIAPIKey, geminiAPIKey string) *AIService {
-	return &AIService{
-		OpenAIAPIKey: openAIAPIKey,
-		GeminiAPIKey: geminiAPIKey,
-	}
+// TranscriptionRequest describes the audio to transcribe. Prompt holds the
+// user's own instructions and may be empty. TranscriptLanguage is the BCP-47
+// tag of the language spoken, empty to have it detected; SummaryLanguage is
+// the tag the summary is written in, empty for the spoken language.
+type TranscriptionRequest struct {
+	AudioFilePath      string
+	Prompt             string
+	TranscriptLanguage string
+	SummaryLanguage    string
 }
 
-// GenerateOpenAIEmbedding generates an embedding for the given text using the OpenAI API
-// This is a wrapper around the standalone function to make it a method of AIService
-func (a *AIService) GenerateOpenAIEmbedding(text string) ([]float32, error) {
-	if a.OpenAIAPIKey == "" {
-		return nil, fmt.Errorf("OpenAI API key not provided")
-	}
-	return GenerateOpenAIEmbedding(text, a.OpenAIAPIKey)
+// Transcription is the result of transcribing an audio file. Everything but
+// the transcript is only filled in by providers that report it. Language is
+// the spoken language as the provider names it, which may be a code or a name.
+// Provider is set by a TranscriberChain to the provider that succeeded.
+type Transcription struct {
+	Provider    string    `json:"-"`
+	Transcript  string    `json:"transcript"`
+	Summary     string    `json:"summary,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	KeyPoints   []string  `json:"key_points,omitempty"`
+	ActionItems []string  `json:"action_items,omitempty"`
+	Segments    []Segment `json:"segments,omitempty"`
 }
 
-// AskLLM sends a prompt to the Gemini API and returns the response
-func (a *AIService) AskLLM(prompt string) (string, error) {
-	// Check if Gemini API key is available
-	if a.GeminiAPIKey == "" {
-		return "", fmt.Errorf("Gemini API key not provided")
-	}
+// Segment is a timed stretch of the transcript. Start and End are offsets
+// into the audio in seconds. Speaker is empty unless the provider labels
+// speakers.
+type Segment struct {
+	Start   float64 `json:"start"`
+	End     float64 `json:"end"`
+	Speaker string  `json:"speaker,omitempty"`
+	Text    string  `json:"text"`
+}
 
-	// Create a Gemini service instance
-	geminiService := NewGeminiService(a.GeminiAPIKey)
+// ChatModel answers text prompts, either all at once or streamed token by token
+type ChatModel interface {
+	Name() string
+	Complete(ctx context.Context, prompt string) (string, error)
+	Stream(ctx context.Context, prompt string, onToken TokenHandler) (string, error)
+}
 
-	// Call the Gemini API for text completion
-	return geminiService.AskGemini(prompt)
+// Embedder turns text into a vector for semantic search
+type Embedder interface {
+	Name() string
+	Embed(ctx context.Context, text string) ([]float32, error)
 }
@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TranscriberChain tries each transcriber in order until one succeeds
+type TranscriberChain []Transcriber
+
+// Name lists the providers of the chain in the order they are tried
+func (c TranscriberChain) Name() string {
+	names := make([]string, len(c))
+	for i, t := range c {
+		names[i] = t.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Languages are those every provider of the chain supports, so falling back
+// never hands a provider a language it can't handle
+func (c TranscriberChain) Languages() []string {
+	lists := make([][]string, len(c))
+	for i, t := range c {
+		lists[i] = providerLanguages(t)
+	}
+	return intersectLanguages(lists...)
+}
+
+// Transcribe returns the first successful transcription. If every provider
+// fails, the error lists each provider's failure.
+func (c TranscriberChain) Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcription, error) {
+	var errs []error
+
+	for _, t := range c {
+		result, err := t.Transcribe(ctx, req)
+		if err == nil {
+			result.Provider = t.Name()
+			return result, nil
+		}
+
+		// Don't try the next provider for a request that was cancelled
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", t.Name(), err))
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// ChatModelChain tries each chat model in order until one succeeds
+type ChatModelChain []ChatModel
+
+// Name lists the providers of the chain in the order they are tried
+func (c ChatModelChain) Name() string {
+	names := make([]string, len(c))
+	for i, m := range c {
+		names[i] = m.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Languages are those every provider of the chain supports
+func (c ChatModelChain) Languages() []string {
+	lists := make([][]string, len(c))
+	for i, m := range c {
+		lists[i] = providerLanguages(m)
+	}
+	return intersectLanguages(lists...)
+}
+
+// Complete returns the first successful answer. If every provider fails, the
+// error lists each provider's failure.
+func (c ChatModelChain) Complete(ctx context.Context, prompt string) (string, error) {
+	var errs []error
+
+	for _, m := range c {
+		answer, err := m.Complete(ctx, prompt)
+		if err == nil {
+			return answer, nil
+		}
+
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", m.Name(), err))
+	}
+
+	return "", errors.Join(errs...)
+}
+
+// Stream falls back to the next provider only while nothing has been sent to
+// onToken; once a provider has started answering, its error is returned as is
+// so the caller never receives two answers mixed together.
+func (c ChatModelChain) Stream(ctx context.Context, prompt string, onToken TokenHandler) (string, error) {
+	var errs []error
+
+	for _, m := range c {
+		started := false
+		answer, err := m.Stream(ctx, prompt, func(text string) error {
+			started = true
+			return onToken(text)
+		})
+		if err == nil {
+			return answer, nil
+		}
+
+		if started || ctx.Err() != nil {
+			return answer, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", m.Name(), err))
+	}
+
+	return "", errors.Join(errs...)
+}
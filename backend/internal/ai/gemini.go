@@ -2,6 +2,7 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -11,25 +12,34 @@ import (
 	"path/filepath"
 )
 
+// geminiModelURL is the model used for both audio and text requests. The
+// method, e.g. :generateContent, is appended to it.
+const geminiModelURL = "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash-preview-04-17"
+
 // GeminiService handles direct audio processing using Gemini Pro 1.5
 type GeminiService struct {
-	APIKey string
+	APIKey   string
+	ModelURL string
 }
 
 // NewGeminiService creates a new Gemini service instance
 func NewGeminiService(apiKey string) *GeminiService {
 	return &GeminiService{
-		APIKey: apiKey,
+		APIKey:   apiKey,
+		ModelURL: geminiModelURL,
 	}
 }
 
 // GeminiRequest represents the request structure for Gemini API
 type GeminiRequest struct {
-	Contents []Content `json:"contents"`
+	Contents         []Content         `json:"contents"`
+	GenerationConfig *GenerationConfig `json:"generationConfig,omitempty"`
 }
 
-// Content represents a content part in the Gemini request
+// Content represents a turn of the conversation in the Gemini request. Role
+// is "user" or "model" and may be left empty for single-turn requests.
 type Content struct {
+	Role  string `json:"role,omitempty"`
 	Parts []Part `json:"parts"`
 }
 
@@ -45,6 +55,13 @@ type InlineData struct {
 	Data     string `json:"data"` // base64 encoded data
 }
 
+// GenerationConfig asks Gemini for a response of a given type. With
+// ResponseSchema set, the response is JSON matching the schema.
+type GenerationConfig struct {
+	ResponseMimeType string  `json:"responseMimeType,omitempty"`
+	ResponseSchema   *Schema `json:"responseSchema,omitempty"`
+}
+
 // GeminiResponse represents the response from Gemini API
 type GeminiResponse struct {
 	Candidates []struct {
@@ -57,13 +74,19 @@ type GeminiResponse struct {
 	} `json:"candidates"`
 }
 
-// AskGemini sends a text prompt to Gemini and returns the response
-func (g *GeminiService) AskGemini(prompt string) (string, error) {
-	// Create a new HTTP request
-	url := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash-preview-04-17:generateContent"
+// Name identifies the provider in configuration and errors
+func (g *GeminiService) Name() string {
+	return "gemini"
+}
+
+// Languages lists the languages Gemini transcribes and writes in
+func (g *GeminiService) Languages() []string {
+	return geminiLanguages
+}
 
-	// Use the Gemini JSON API format for text-only request
-	jsonRequest := GeminiRequest{
+// Complete sends a text prompt to Gemini and returns the response
+func (g *GeminiService) Complete(ctx context.Context, prompt string) (string, error) {
+	return g.generateContent(ctx, GeminiRequest{
 		Contents: []Content{
 			{
 				Parts: []Part{
@@ -73,112 +96,123 @@ func (g *GeminiService) AskGemini(prompt string) (string, error) {
 				},
 			},
 		},
-	}
+	})
+}
 
-	jsonData, err := json.Marshal(jsonRequest)
+// Transcribe sends the audio to Gemini, which returns the transcript, the
+// summary and the rest of the analysis in a single structured response
+func (g *GeminiService) Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcription, error) {
+	analysis, err := g.AnalyzeAudio(ctx, req.AudioFilePath, buildAudioPrompt(req.Prompt, req.TranscriptLanguage, req.SummaryLanguage))
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+		return nil, err
 	}
 
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	return &Transcription{
+		Transcript:  analysis.Transcript,
+		Segments:    analysis.Segments,
+		Summary:     analysis.Summary,
+		Language:    analysis.Language,
+		Title:       analysis.Title,
+		KeyPoints:   analysis.KeyPoints,
+		ActionItems: analysis.ActionItems,
+	}, nil
+}
+
+// AnalyzeAudio sends an audio file to Gemini and asks for an AudioAnalysis as
+// JSON. Output that doesn't match the schema is sent back to the model with
+// the validation error for one corrective retry.
+func (g *GeminiService) AnalyzeAudio(ctx context.Context, audioFilePath, prompt string) (*AudioAnalysis, error) {
+	audio, err := audioPart(audioFilePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	// Set headers
-	req.Header.Set("Content-Type", "application/json")
-
-	// Add API key as query parameter
-	q := req.URL.Query()
-	q.Add("key", g.APIKey)
-	req.URL.RawQuery = q.Encode()
+	request := GeminiRequest{
+		Contents: []Content{
+			{
+				Role: "user",
+				Parts: []Part{
+					{
+						Text: prompt,
+					},
+					audio,
+				},
+			},
+		},
+		GenerationConfig: &GenerationConfig{
+			ResponseMimeType: "application/json",
+			ResponseSchema:   audioAnalysisSchema,
+		},
+	}
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	output, err := g.generateContent(ctx, request)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check for errors
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status code %d): %s", resp.StatusCode, string(body))
+	analysis, validationErr := parseAudioAnalysis(output)
+	if validationErr == nil {
+		return analysis, nil
 	}
 
-	// Parse the response
-	var result GeminiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	// Show the model its own answer and what was wrong with it
+	request.Contents = append(request.Contents,
+		Content{
+			Role:  "model",
+			Parts: []Part{{Text: output}},
+		},
+		Content{
+			Role:  "user",
+			Parts: []Part{{Text: fmt.Sprintf("That response is invalid: %v. Respond again with only a JSON object that matches the response schema.", validationErr)}},
+		},
+	)
+
+	output, err = g.generateContent(ctx, request)
+	if err != nil {
+		return nil, err
 	}
 
-	// Extract the text
-	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
-		return "", fmt.Errorf("no response generated")
+	analysis, validationErr = parseAudioAnalysis(output)
+	if validationErr != nil {
+		return nil, fmt.Errorf("invalid structured output after retry: %w", validationErr)
 	}
 
-	return result.Candidates[0].Content.Parts[0].Text, nil
+	return analysis, nil
 }
 
-// ProcessAudioFile sends an audio file directly to Gemini Pro 1.5 for processing
-// and returns the summary or transcript as specified in the prompt
-func (g *GeminiService) ProcessAudioFile(audioFilePath, prompt string) (string, error) {
+// audioPart reads an audio file into an inline data part
+func audioPart(audioFilePath string) (Part, error) {
 	// Check if file exists
 	if _, err := os.Stat(audioFilePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("audio file does not exist: %w", err)
-	}
-
-	// Determine content type based on file extension
-	ext := filepath.Ext(audioFilePath)
-	var contentType string
-	switch ext {
-	case ".mp3":
-		contentType = "audio/mpeg"
-	case ".wav":
-		contentType = "audio/wav"
-	case ".ogg":
-		contentType = "audio/ogg"
-	case ".m4a":
-		contentType = "audio/mp4"
-	default:
-		contentType = "audio/mpeg" // Default
+		return Part{}, fmt.Errorf("audio file does not exist: %w", err)
 	}
 
-	// Create a new HTTP request
-	url := "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash-preview-04-17:generateContent"
-
 	// Open the audio file
 	file, err := os.Open(audioFilePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open audio file: %w", err)
+		return Part{}, fmt.Errorf("failed to open audio file: %w", err)
 	}
 	defer file.Close()
 
 	// Read file content
 	fileContent, err := io.ReadAll(file)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file content: %w", err)
+		return Part{}, fmt.Errorf("failed to read file content: %w", err)
 	}
 
-	// Use the Gemini JSON API format
-	jsonRequest := GeminiRequest{
-		Contents: []Content{
-			{
-				Parts: []Part{
-					{
-						Text: prompt,
-					},
-					{
-						InlineData: &InlineData{
-							MimeType: contentType,
-							Data:     base64.StdEncoding.EncodeToString(fileContent),
-						},
-					},
-				},
-			},
+	return Part{
+		InlineData: &InlineData{
+			MimeType: audioContentType(audioFilePath),
+			Data:     base64.StdEncoding.EncodeToString(fileContent),
 		},
+	}, nil
+}
+
+// generateContent sends the request to Gemini and returns the text of the
+// first candidate
+func (g *GeminiService) generateContent(ctx context.Context, jsonRequest GeminiRequest) (string, error) {
+	if g.APIKey == "" {
+		return "", fmt.Errorf("Gemini API key not provided")
 	}
 
 	jsonData, err := json.Marshal(jsonRequest)
@@ -187,7 +221,7 @@ func (g *GeminiService) ProcessAudioFile(audioFilePath, prompt string) (string,
 	}
 
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", g.ModelURL+":generateContent", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -220,10 +254,26 @@ func (g *GeminiService) ProcessAudioFile(audioFilePath, prompt string) (string,
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	// Extract the summary
+	// Extract the text
 	if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
 		return "", fmt.Errorf("no response generated")
 	}
 
 	return result.Candidates[0].Content.Parts[0].Text, nil
 }
+
+// audioContentType determines the MIME type of an audio file from its extension
+func audioContentType(audioFilePath string) string {
+	switch filepath.Ext(audioFilePath) {
+	case ".mp3":
+		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".ogg":
+		return "audio/ogg"
+	case ".m4a":
+		return "audio/mp4"
+	default:
+		return "audio/mpeg" // Default
+	}
+}
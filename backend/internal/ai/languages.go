@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Language is a language a pipeline can transcribe or summarize in, identified
+// by its BCP-47 primary language subtag
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// languageNames holds every language the application knows by its BCP-47
+// primary subtag. Providers declare which of these they support.
+var languageNames = map[string]string{
+	"af": "Afrikaans", "am": "Amharic", "ar": "Arabic", "az": "Azerbaijani",
+	"be": "Belarusian", "bg": "Bulgarian", "bn": "Bengali", "bs": "Bosnian",
+	"ca": "Catalan", "cs": "Czech", "cy": "Welsh", "da": "Danish",
+	"de": "German", "el": "Greek", "en": "English", "es": "Spanish",
+	"et": "Estonian", "fa": "Persian", "fi": "Finnish", "fr": "French",
+	"gl": "Galician", "gu": "Gujarati", "he": "Hebrew", "hi": "Hindi",
+	"hr": "Croatian", "hu": "Hungarian", "hy": "Armenian", "id": "Indonesian",
+	"is": "Icelandic", "it": "Italian", "ja": "Japanese", "kk": "Kazakh",
+	"kn": "Kannada", "ko": "Korean", "lt": "Lithuanian", "lv": "Latvian",
+	"mi": "Maori", "mk": "Macedonian", "ml": "Malayalam", "mr": "Marathi",
+	"ms": "Malay", "ne": "Nepali", "nl": "Dutch", "no": "Norwegian",
+	"pa": "Punjabi", "pl": "Polish", "pt": "Portuguese", "ro": "Romanian",
+	"ru": "Russian", "sk": "Slovak", "sl": "Slovenian", "sq": "Albanian",
+	"sr": "Serbian", "sv": "Swedish", "sw": "Swahili", "ta": "Tamil",
+	"te": "Telugu", "th": "Thai", "tl": "Tagalog", "tr": "Turkish",
+	"uk": "Ukrainian", "ur": "Urdu", "vi": "Vietnamese", "zh": "Chinese",
+}
+
+// whisperLanguages are the languages Whisper models transcribe well enough to
+// be offered, as listed in OpenAI's documentation
+var whisperLanguages = []string{
+	"af", "ar", "az", "be", "bg", "bs", "ca", "cs", "cy", "da", "de", "el", "en", "es", "et", "fa",
+	"fi", "fr", "gl", "he", "hi", "hr", "hu", "hy", "id", "is", "it", "ja", "kk", "kn", "ko", "lt",
+	"lv", "mi", "mk", "mr", "ms", "ne", "nl", "no", "pl", "pt", "ro", "ru", "sk", "sl", "sr", "sv",
+	"sw", "ta", "th", "tl", "tr", "uk", "ur", "vi", "zh",
+}
+
+// geminiLanguages are the languages Gemini transcribes and writes in
+var geminiLanguages = append([]string{"am", "bn", "gu", "ml", "pa", "sq", "te"}, whisperLanguages...)
+
+// LanguageSupporter is implemented by providers that only handle some
+// languages. Providers that don't implement it are taken to support every
+// language in the table.
+type LanguageSupporter interface {
+	Languages() []string
+}
+
+// ParseLanguage turns a BCP-47 tag, or the English name of a language, into
+// a canonical tag such as "en", "pt-BR" or "zh-Hant". It fails for tags that
+// are malformed or whose language isn't in the table.
+func ParseLanguage(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	// Providers and older clients name languages in English
+	for code, name := range languageNames {
+		if strings.EqualFold(value, name) {
+			return code, nil
+		}
+	}
+
+	subtags := strings.Split(strings.ReplaceAll(value, "_", "-"), "-")
+
+	primary := strings.ToLower(subtags[0])
+	if _, ok := languageNames[primary]; !ok {
+		return "", fmt.Errorf("unknown language %q", value)
+	}
+
+	tag := []string{primary}
+	for i, subtag := range subtags[1:] {
+		switch {
+		case i == 0 && len(subtag) == 4 && isAlpha(subtag):
+			// Script, e.g. Hant
+			tag = append(tag, strings.ToUpper(subtag[:1])+strings.ToLower(subtag[1:]))
+		case len(subtag) == 2 && isAlpha(subtag):
+			// Region, e.g. BR
+			tag = append(tag, strings.ToUpper(subtag))
+		case len(subtag) == 3 && strings.Trim(subtag, "0123456789") == "":
+			// UN M.49 region, e.g. 419
+			tag = append(tag, subtag)
+		default:
+			return "", fmt.Errorf("malformed language tag %q", value)
+		}
+	}
+
+	return strings.Join(tag, "-"), nil
+}
+
+// BaseLanguage returns the primary language subtag of a tag
+func BaseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+// LanguageName returns the English name of the tag's language, or the tag
+// itself if it isn't known
+func LanguageName(tag string) string {
+	if name, ok := languageNames[BaseLanguage(tag)]; ok {
+		return name
+	}
+	return tag
+}
+
+// Languages returns the table entries for the given codes sorted by name.
+// Nil means every known language.
+func Languages(codes []string) []Language {
+	if codes == nil {
+		codes = allLanguages()
+	}
+
+	languages := make([]Language, 0, len(codes))
+	for _, code := range codes {
+		languages = append(languages, Language{Code: code, Name: languageNames[code]})
+	}
+
+	sort.Slice(languages, func(i, j int) bool {
+		return languages[i].Name < languages[j].Name
+	})
+
+	return languages
+}
+
+// LanguageSupported reports whether the tag's language is among codes. Nil
+// codes support every known language.
+func LanguageSupported(codes []string, tag string) bool {
+	base := BaseLanguage(tag)
+	if codes == nil {
+		_, ok := languageNames[base]
+		return ok
+	}
+
+	for _, code := range codes {
+		if code == base {
+			return true
+		}
+	}
+
+	return false
+}
+
+// providerLanguages returns the languages a provider declares, or nil if it
+// doesn't declare any
+func providerLanguages(provider any) []string {
+	if s, ok := provider.(LanguageSupporter); ok {
+		return s.Languages()
+	}
+	return nil
+}
+
+// intersectLanguages returns the codes every list contains, keeping nil lists
+// as "every language"
+func intersectLanguages(lists ...[]string) []string {
+	var result []string
+	for _, list := range lists {
+		if list == nil {
+			continue
+		}
+		if result == nil {
+			result = append([]string{}, list...)
+			continue
+		}
+
+		kept := result[:0]
+		for _, code := range result {
+			if LanguageSupported(list, code) {
+				kept = append(kept, code)
+			}
+		}
+		result = kept
+	}
+
+	return result
+}
+
+// allLanguages returns the codes of every known language
+func allLanguages() []string {
+	codes := make([]string, 0, len(languageNames))
+	for code := range languageNames {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
+
+func isAlpha(s string) bool {
+	for _, r := range s {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// OllamaService talks to a self-hosted Ollama-compatible server for chat
+// completions and embeddings
+type OllamaService struct {
+	BaseURL        string
+	ChatModel      string
+	EmbeddingModel string
+}
+
+// NewOllamaService creates a new Ollama service instance
+func NewOllamaService(baseURL, chatModel, embeddingModel string) *OllamaService {
+	return &OllamaService{
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		ChatModel:      chatModel,
+		EmbeddingModel: embeddingModel,
+	}
+}
+
+// OllamaChatRequest defines the structure for the request to Ollama's /api/chat
+type OllamaChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// OllamaChatResponse is a complete response, or one line of a streamed
+// response, from Ollama's /api/chat
+type OllamaChatResponse struct {
+	Message Message `json:"message"`
+	Done    bool    `json:"done"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// OllamaEmbeddingRequest defines the structure for the request to Ollama's /api/embeddings
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+// OllamaEmbeddingResponse defines the structure for the response from Ollama's /api/embeddings
+type OllamaEmbeddingResponse struct {
+	Embedding []float32 `json:"embedding"`
+}
+
+// Name identifies the provider in configuration and errors
+func (o *OllamaService) Name() string {
+	return "ollama"
+}
+
+// Complete sends a prompt to the chat model and returns its answer
+func (o *OllamaService) Complete(ctx context.Context, prompt string) (string, error) {
+	resp, err := o.chat(ctx, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result OllamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if result.Message.Content == "" {
+		return "", fmt.Errorf("no response generated")
+	}
+
+	return result.Message.Content, nil
+}
+
+// Stream sends a prompt to the chat model and calls onToken with every piece
+// of the answer. Ollama streams one JSON object per line rather than
+// server-sent events.
+func (o *OllamaService) Stream(ctx context.Context, prompt string, onToken TokenHandler) (string, error) {
+	resp, err := o.chat(ctx, prompt, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer bytes.Buffer
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var chunk OllamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return answer.String(), fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+
+		if chunk.Error != "" {
+			return answer.String(), fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+
+		if text := chunk.Message.Content; text != "" {
+			answer.WriteString(text)
+			if err := onToken(text); err != nil {
+				return answer.String(), err
+			}
+		}
+
+		if chunk.Done {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	if answer.Len() == 0 {
+		return "", fmt.Errorf("no response generated")
+	}
+
+	return answer.String(), nil
+}
+
+// chat sends the prompt to /api/chat and returns the response once its status
+// has been checked. The caller must close the body.
+func (o *OllamaService) chat(ctx context.Context, prompt string, stream bool) (*http.Response, error) {
+	if o.BaseURL == "" {
+		return nil, fmt.Errorf("Ollama base URL not provided")
+	}
+
+	requestBody := OllamaChatRequest{
+		Model: o.ChatModel,
+		Messages: []Message{
+			{
+				Role:    "user",
+				Content: prompt,
+			},
+		},
+		Stream: stream,
+	}
+
+	return o.post(ctx, "/api/chat", requestBody)
+}
+
+// Embed generates an embedding for the text with the configured embedding model
+func (o *OllamaService) Embed(ctx context.Context, text string) ([]float32, error) {
+	if o.BaseURL == "" {
+		return nil, fmt.Errorf("Ollama base URL not provided")
+	}
+	if o.EmbeddingModel == "" {
+		return nil, fmt.Errorf("Ollama embedding model not provided")
+	}
+
+	resp, err := o.post(ctx, "/api/embeddings", OllamaEmbeddingRequest{
+		Model:  o.EmbeddingModel,
+		Prompt: text,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result OllamaEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(result.Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding data received from Ollama")
+	}
+
+	return result.Embedding, nil
+}
+
+// post sends body as JSON to the given path of the server
+func (o *OllamaService) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status code %d): %s", resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
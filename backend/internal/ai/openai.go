@@ -2,11 +2,49 @@ package ai
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 )
 
+// OpenAIService uses the OpenAI API, or any API compatible with it, for chat
+// completions and embeddings
+type OpenAIService struct {
+	APIKey    string
+	BaseURL   string
+	ChatModel string
+	name      string
+}
+
+// NewOpenAIService creates a new OpenAI service instance
+func NewOpenAIService(apiKey string) *OpenAIService {
+	return &OpenAIService{
+		APIKey:    apiKey,
+		BaseURL:   "https://api.openai.com/v1",
+		ChatModel: "gpt-3.5-turbo",
+		name:      "openai",
+	}
+}
+
+// NewDeepSeekService creates a service for DeepSeek's OpenAI-compatible chat
+// completion API
+func NewDeepSeekService(apiKey, baseURL string) *OpenAIService {
+	return &OpenAIService{
+		APIKey:    apiKey,
+		BaseURL:   strings.TrimRight(baseURL, "/"),
+		ChatModel: "deepseek-chat",
+		name:      "deepseek",
+	}
+}
+
+// Name identifies the provider in configuration and errors
+func (o *OpenAIService) Name() string {
+	return o.name
+}
+
 // OpenAIEmbeddingRequest defines the structure for the request to OpenAI's embedding API.
 type OpenAIEmbeddingRequest struct {
 	Input string `json:"input"`
@@ -65,10 +103,10 @@ type OpenAICompletionResponse struct {
 	} `json:"usage"`
 }
 
-// AskOpenAI sends a prompt to the OpenAI API and returns the completion response.
-func AskOpenAI(prompt string, apiKey string) (string, error) {
-	requestBody := OpenAICompletionRequest{
-		Model: "gpt-3.5-turbo",
+// chatRequest returns the completion request for a single user prompt
+func (o *OpenAIService) chatRequest(prompt string) OpenAICompletionRequest {
+	return OpenAICompletionRequest{
+		Model: o.ChatModel,
 		Messages: []Message{
 			{
 				Role:    "system",
@@ -82,82 +120,83 @@ func AskOpenAI(prompt string, apiKey string) (string, error) {
 		Temperature: 0.7,
 		MaxTokens:   1000,
 	}
+}
+
+// post sends body as JSON to the given path of the API. The caller must close
+// the body of the response.
+func (o *OpenAIService) post(ctx context.Context, path string, body interface{}) (*http.Response, error) {
+	if o.APIKey == "" {
+		return nil, fmt.Errorf("%s API key not provided", o.name)
+	}
 
-	jsonData, err := json.Marshal(requestBody)
+	jsonData, err := json.Marshal(body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", o.BaseURL+path, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request to OpenAI API: %w", err)
+		return nil, fmt.Errorf("failed to make request to %s API: %w", o.name, err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("OpenAI API request failed with status code: %d", resp.StatusCode)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s API error (status code %d): %s", o.name, resp.StatusCode, string(body))
 	}
 
+	return resp, nil
+}
+
+// Complete sends a prompt to the chat completion API and returns the answer
+func (o *OpenAIService) Complete(ctx context.Context, prompt string) (string, error) {
+	resp, err := o.post(ctx, "/chat/completions", o.chatRequest(prompt))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
 	var completionResponse OpenAICompletionResponse
 	if err := json.NewDecoder(resp.Body).Decode(&completionResponse); err != nil {
-		return "", fmt.Errorf("failed to decode OpenAI API response: %w", err)
+		return "", fmt.Errorf("failed to decode %s API response: %w", o.name, err)
 	}
 
 	if len(completionResponse.Choices) == 0 {
-		return "", fmt.Errorf("no completion data received from OpenAI API")
+		return "", fmt.Errorf("no completion data received from %s API", o.name)
 	}
 
 	return completionResponse.Choices[0].Message.Content, nil
 }
 
-// GenerateOpenAIEmbedding generates an embedding for the given text using the OpenAI API.
-func GenerateOpenAIEmbedding(text string, apiKey string) ([]float32, error) {
+// Embed generates an embedding for the text with text-embedding-ada-002
+func (o *OpenAIService) Embed(ctx context.Context, text string) ([]float32, error) {
 	requestBody := OpenAIEmbeddingRequest{
 		Input: text,
 		Model: "text-embedding-ada-002",
 	}
 
-	jsonData, err := json.Marshal(requestBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/embeddings", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := o.post(ctx, "/embeddings", requestBody)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request to OpenAI API: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		// Consider reading the response body for more detailed error information from OpenAI
-		return nil, fmt.Errorf("OpenAI API request failed with status code: %d", resp.StatusCode)
-	}
-
 	var embeddingResponse OpenAIEmbeddingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&embeddingResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode OpenAI API response: %w", err)
+		return nil, fmt.Errorf("failed to decode %s API response: %w", o.name, err)
 	}
 
 	if len(embeddingResponse.Data) == 0 {
-		return nil, fmt.Errorf("no embedding data received from OpenAI API")
+		return nil, fmt.Errorf("no embedding data received from %s API", o.name)
 	}
 
 	return embeddingResponse.Data[0].Embedding, nil
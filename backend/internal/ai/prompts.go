@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// languageInstruction tells the model which language to write the summary in.
+// Without one, the summary follows the transcript.
+func languageInstruction(language string) string {
+	if language == "" {
+		return "in the language that the transcript is in"
+	}
+
+	return fmt.Sprintf("in %s (%s)", LanguageName(language), language)
+}
+
+// buildAudioPrompt returns the prompt sent with the audio to providers that
+// transcribe and summarize in one pass. The response schema fixes the format,
+// so custom prompts only need to say what the summary should cover.
+func buildAudioPrompt(prompt, transcriptLanguage, summaryLanguage string) string {
+	if prompt == "" {
+		prompt = "Please transcribe this audio and provide a detailed summary of its content. Include key points and main topics"
+	}
+
+	spoken := "Detect the language spoken and transcribe it without translating"
+	if transcriptLanguage != "" {
+		spoken = fmt.Sprintf("The audio is in %s (%s); transcribe it without translating", LanguageName(transcriptLanguage), transcriptLanguage)
+	}
+
+	return fmt.Sprintf("%s. %s. Transcribe the audio verbatim as consecutive segments with their start and end offsets in seconds, labelling who speaks each one. Write the summary, key points, title and action items %s, and report the language spoken in the audio.", prompt, spoken, languageInstruction(summaryLanguage))
+}
+
+// BuildSummaryPrompt returns the prompt used to summarize an existing transcript
+func BuildSummaryPrompt(prompt, language, transcript string) string {
+	if prompt == "" {
+		prompt = "Please provide a detailed summary of the following transcript. Include key points and main topics"
+	}
+
+	return fmt.Sprintf("%s. Write the summary without any explanation at the beginning that it's the summary, %s.\n\nTranscript:\n%s", prompt, languageInstruction(language), transcript)
+}
+
+// Summarize asks the chat model for a summary of the transcript following the
+// user's prompt, written in the given language
+func Summarize(ctx context.Context, model ChatModel, transcript, prompt, language string) (string, error) {
+	summary, err := model.Complete(ctx, BuildSummaryPrompt(prompt, language, transcript))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(summary), nil
+}
+
+// maxTranslationChars limits how much text is sent in one translation
+// request, so long transcripts stay within the model's output limit
+const maxTranslationChars = 6000
+
+// translationTimeout bounds the translation of one part, so a stalled
+// provider can't hold a job forever
+const translationTimeout = 2 * time.Minute
+
+// BuildTranslationPrompt returns the prompt used to translate text
+func BuildTranslationPrompt(language, text string) string {
+	return fmt.Sprintf("Translate the following text into %s (%s). Keep the line breaks, speaker labels, names and numbers as they are, and reply with the translation only, without any explanation.\n\nText:\n%s", LanguageName(language), language, text)
+}
+
+// Translate asks the chat model to translate the text into the given language.
+// Long text is split at line breaks and translated a part at a time, each
+// within translationTimeout.
+func Translate(ctx context.Context, model ChatModel, text, language string) (string, error) {
+	var translated []string
+
+	for _, part := range splitText(text, maxTranslationChars) {
+		partCtx, cancel := context.WithTimeout(ctx, translationTimeout)
+		answer, err := model.Complete(partCtx, BuildTranslationPrompt(language, part))
+		cancel()
+		if err != nil {
+			return "", err
+		}
+		translated = append(translated, strings.TrimSpace(answer))
+	}
+
+	return strings.Join(translated, "\n"), nil
+}
+
+// splitText cuts text into parts of at most limit bytes, breaking between
+// lines, or between words for lines that are too long on their own
+func splitText(text string, limit int) []string {
+	var parts []string
+	var current strings.Builder
+
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			parts = append(parts, current.String())
+		}
+		current.Reset()
+	}
+
+	add := func(piece, separator string) {
+		if current.Len() > 0 && current.Len()+len(separator)+len(piece) > limit {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(separator)
+		}
+		current.WriteString(piece)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		if len(line) <= limit {
+			add(line, "\n")
+			continue
+		}
+
+		flush()
+		for _, word := range strings.Fields(line) {
+			add(word, " ")
+		}
+		flush()
+	}
+	flush()
+
+	return parts
+}
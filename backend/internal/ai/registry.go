@@ -0,0 +1,226 @@
+package ai
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DefaultPipeline is the name of the pipeline built from Config.Transcription
+// and Config.Chat. It is used when neither the request nor the user picks one.
+const DefaultPipeline = "default"
+
+// Config selects the provider used for each capability. Transcription and
+// Chat are fallback chains tried in order; embeddings come from a single
+// provider because vectors from different models can't be compared.
+type Config struct {
+	OpenAIAPIKey   string
+	GeminiAPIKey   string
+	WhisperAPIKey  string
+	DeepseekAPIKey string
+
+	// Base URLs of OpenAI-compatible APIs
+	WhisperURL  string
+	DeepseekURL string
+
+	// Self-hosted servers
+	OllamaURL            string
+	OllamaChatModel      string
+	OllamaEmbeddingModel string
+	WhisperCppURL        string
+
+	Transcription []string
+	Chat          []string
+	Embedding     string
+
+	// Pipelines are alternatives to the default pipeline that requests and
+	// users can choose by name
+	Pipelines map[string]PipelineConfig
+}
+
+// PipelineConfig names the providers of a pipeline, each a fallback chain
+type PipelineConfig struct {
+	Transcription []string `json:"transcription"`
+	Summarization []string `json:"summarization"`
+}
+
+// Pipeline is a transcriber paired with the chat model that summarizes its
+// transcripts when the transcriber doesn't summarize them itself
+type Pipeline struct {
+	Name        string
+	Transcriber Transcriber
+	Summarizer  ChatModel
+}
+
+// Registry holds the providers the application uses. Callers depend only on
+// the interfaces, so a deployment can mix providers through configuration.
+type Registry struct {
+	Transcriber Transcriber
+	Chat        ChatModel
+	Embedder    Embedder
+
+	pipelines map[string]*Pipeline
+}
+
+// NewRegistry builds the providers named in the config. Providers whose API
+// key or base URL is missing are still created and fail when used, which lets
+// a chain fall through to the next provider.
+func NewRegistry(cfg Config) (*Registry, error) {
+	gemini := NewGeminiService(cfg.GeminiAPIKey)
+	openai := NewOpenAIService(cfg.OpenAIAPIKey)
+	deepseek := NewDeepSeekService(cfg.DeepseekAPIKey, cfg.DeepseekURL)
+	whisper := NewWhisperService(cfg.WhisperAPIKey, cfg.WhisperURL)
+	ollama := NewOllamaService(cfg.OllamaURL, cfg.OllamaChatModel, cfg.OllamaEmbeddingModel)
+	whisperCpp := NewWhisperCppService(cfg.WhisperCppURL)
+
+	b := &builder{
+		transcribers: map[string]Transcriber{
+			gemini.Name():     gemini,
+			whisper.Name():    whisper,
+			whisperCpp.Name(): whisperCpp,
+		},
+		chatModels: map[string]ChatModel{
+			gemini.Name():   gemini,
+			openai.Name():   openai,
+			deepseek.Name(): deepseek,
+			ollama.Name():   ollama,
+		},
+	}
+
+	embedders := map[string]Embedder{
+		openai.Name(): openai,
+		ollama.Name(): ollama,
+	}
+
+	transcriber, err := b.transcriber(cfg.Transcription)
+	if err != nil {
+		return nil, err
+	}
+
+	chat, err := b.chatModel(cfg.Chat)
+	if err != nil {
+		return nil, err
+	}
+
+	embedder, ok := embedders[cfg.Embedding]
+	if !ok {
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Embedding)
+	}
+
+	registry := &Registry{
+		Transcriber: transcriber,
+		Chat:        chat,
+		Embedder:    embedder,
+		pipelines: map[string]*Pipeline{
+			DefaultPipeline: {Name: DefaultPipeline, Transcriber: transcriber, Summarizer: chat},
+		},
+	}
+
+	for name, pc := range cfg.Pipelines {
+		if name == DefaultPipeline {
+			return nil, fmt.Errorf("pipeline name %q is reserved", name)
+		}
+
+		transcriber, err := b.transcriber(pc.Transcription)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: %w", name, err)
+		}
+
+		summarizer, err := b.chatModel(pc.Summarization)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %q: %w", name, err)
+		}
+
+		registry.pipelines[name] = &Pipeline{Name: name, Transcriber: transcriber, Summarizer: summarizer}
+	}
+
+	return registry, nil
+}
+
+// Pipeline returns the pipeline with the given name, or the default pipeline
+// when name is empty
+func (r *Registry) Pipeline(name string) (*Pipeline, error) {
+	if name == "" {
+		name = DefaultPipeline
+	}
+
+	pipeline, ok := r.pipelines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown pipeline %q", name)
+	}
+
+	return pipeline, nil
+}
+
+// TranscriptLanguages are the languages the pipeline can transcribe
+func (p *Pipeline) TranscriptLanguages() []string {
+	return providerLanguages(p.Transcriber)
+}
+
+// SummaryLanguages are the languages the pipeline can summarize in. Either
+// provider may write the summary, so both have to support the language.
+func (p *Pipeline) SummaryLanguages() []string {
+	return intersectLanguages(providerLanguages(p.Transcriber), providerLanguages(p.Summarizer))
+}
+
+// PipelineNames returns the names of all configured pipelines in order
+func (r *Registry) PipelineNames() []string {
+	names := make([]string, 0, len(r.pipelines))
+	for name := range r.pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// builder resolves provider names into fallback chains
+type builder struct {
+	transcribers map[string]Transcriber
+	chatModels   map[string]ChatModel
+}
+
+// transcriber returns the chain of the named transcribers. A chain of one is
+// just the provider.
+func (b *builder) transcriber(names []string) (Transcriber, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no transcription provider configured")
+	}
+
+	var chain TranscriberChain
+	for _, name := range names {
+		t, ok := b.transcribers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transcription provider %q", name)
+		}
+		chain = append(chain, t)
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
+
+// chatModel returns the chain of the named chat models. A chain of one is just
+// the provider.
+func (b *builder) chatModel(names []string) (ChatModel, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no chat provider configured")
+	}
+
+	var chain ChatModelChain
+	for _, name := range names {
+		m, ok := b.chatModels[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown chat provider %q", name)
+		}
+		chain = append(chain, m)
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
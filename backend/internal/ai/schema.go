@@ -0,0 +1,164 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Schema describes the JSON a model must respond with, in the subset of the
+// OpenAPI schema format Gemini accepts
+type Schema struct {
+	Type             string             `json:"type"`
+	Description      string             `json:"description,omitempty"`
+	Properties       map[string]*Schema `json:"properties,omitempty"`
+	Items            *Schema            `json:"items,omitempty"`
+	Required         []string           `json:"required,omitempty"`
+	PropertyOrdering []string           `json:"propertyOrdering,omitempty"`
+}
+
+// AudioAnalysis is the structured result of processing an audio file. The
+// model returns the transcript as timed segments; Transcript joins their text.
+type AudioAnalysis struct {
+	Transcript  string    `json:"-"`
+	Segments    []Segment `json:"segments"`
+	Summary     string    `json:"summary"`
+	KeyPoints   []string  `json:"key_points"`
+	Title       string    `json:"title"`
+	Language    string    `json:"language"`
+	ActionItems []string  `json:"action_items"`
+}
+
+// audioAnalysisSchema is the response schema of an AudioAnalysis. The
+// transcript segments come first so the model writes them before summarizing.
+var audioAnalysisSchema = &Schema{
+	Type: "OBJECT",
+	Properties: map[string]*Schema{
+		"segments": {
+			Type:        "ARRAY",
+			Description: "Verbatim transcript of the audio split into consecutive segments",
+			Items: &Schema{
+				Type: "OBJECT",
+				Properties: map[string]*Schema{
+					"start":   {Type: "NUMBER", Description: "Offset in seconds where the segment starts"},
+					"end":     {Type: "NUMBER", Description: "Offset in seconds where the segment ends"},
+					"speaker": {Type: "STRING", Description: "Label of the speaker, e.g. Speaker 1, used consistently for the same voice"},
+					"text":    {Type: "STRING", Description: "Verbatim text spoken in the segment"},
+				},
+				Required:         []string{"start", "end", "speaker", "text"},
+				PropertyOrdering: []string{"start", "end", "speaker", "text"},
+			},
+		},
+		"summary":      {Type: "STRING", Description: "Detailed summary of the audio"},
+		"key_points":   {Type: "ARRAY", Items: &Schema{Type: "STRING"}, Description: "Key points and main topics"},
+		"title":        {Type: "STRING", Description: "Short suggested title"},
+		"language":     {Type: "STRING", Description: "BCP-47 tag of the language spoken in the audio, e.g. en or pt-BR"},
+		"action_items": {Type: "ARRAY", Items: &Schema{Type: "STRING"}, Description: "Tasks or follow-ups mentioned, empty if none"},
+	},
+	Required:         []string{"segments", "summary", "key_points", "title", "language", "action_items"},
+	PropertyOrdering: []string{"segments", "summary", "key_points", "title", "language", "action_items"},
+}
+
+// parseAudioAnalysis validates a model's output against audioAnalysisSchema
+// and decodes it. The error describes the first problem found so it can be
+// given back to the model.
+func parseAudioAnalysis(output string) (*AudioAnalysis, error) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &value); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+
+	if err := validateSchema(value, audioAnalysisSchema, "response"); err != nil {
+		return nil, err
+	}
+
+	var analysis AudioAnalysis
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &analysis); err != nil {
+		return nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+
+	texts := make([]string, 0, len(analysis.Segments))
+	for i := range analysis.Segments {
+		segment := &analysis.Segments[i]
+		if segment.Start < 0 || segment.End < segment.Start {
+			return nil, fmt.Errorf("response.segments[%d] must not end before it starts", i)
+		}
+
+		segment.Speaker = strings.TrimSpace(segment.Speaker)
+		segment.Text = strings.TrimSpace(segment.Text)
+		if segment.Text != "" {
+			texts = append(texts, segment.Text)
+		}
+	}
+	analysis.Transcript = strings.Join(texts, "\n")
+
+	// The schema allows empty values, but a note without these is useless
+	switch {
+	case analysis.Transcript == "":
+		return nil, fmt.Errorf("segments must contain the transcript")
+	case strings.TrimSpace(analysis.Summary) == "":
+		return nil, fmt.Errorf("summary must not be empty")
+	}
+
+	analysis.Summary = strings.TrimSpace(analysis.Summary)
+	analysis.Title = strings.TrimSpace(analysis.Title)
+
+	return &analysis, nil
+}
+
+// validateSchema checks a decoded JSON value against the schema. path names
+// the value in error messages.
+func validateSchema(value interface{}, schema *Schema, path string) error {
+	switch schema.Type {
+	case "OBJECT":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				return fmt.Errorf("%s is missing the required field %q", path, name)
+			}
+		}
+
+		for name, field := range object {
+			property, ok := schema.Properties[name]
+			if !ok {
+				return fmt.Errorf("%s has the unexpected field %q", path, name)
+			}
+			if err := validateSchema(field, property, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "ARRAY":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+
+		for i, item := range array {
+			if err := validateSchema(item, schema.Items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "STRING":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "NUMBER", "INTEGER":
+		number, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+		if schema.Type == "INTEGER" && number != float64(int64(number)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "BOOLEAN":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", path)
+		}
+	}
+
+	return nil
+}
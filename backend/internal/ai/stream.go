@@ -0,0 +1,212 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// TokenHandler receives each piece of text as the model generates it.
+// Returning an error stops the stream.
+type TokenHandler func(text string) error
+
+// maxSSELine bounds a single server-sent event line from a provider
+const maxSSELine = 1024 * 1024
+
+// Stream sends a text prompt to Gemini's streaming endpoint and calls onToken
+// with every piece of the answer as it arrives. It returns the full answer
+// once the stream ends.
+func (g *GeminiService) Stream(ctx context.Context, prompt string, onToken TokenHandler) (string, error) {
+	if g.APIKey == "" {
+		return "", fmt.Errorf("Gemini API key not provided")
+	}
+
+	jsonRequest := GeminiRequest{
+		Contents: []Content{
+			{
+				Parts: []Part{
+					{
+						Text: prompt,
+					},
+				},
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(jsonRequest)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", g.ModelURL+":streamGenerateContent", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	// alt=sse makes Gemini send one server-sent event per chunk instead of a
+	// single JSON array
+	q := req.URL.Query()
+	q.Add("key", g.APIKey)
+	q.Add("alt", "sse")
+	req.URL.RawQuery = q.Encode()
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("API error (status code %d): %s", resp.StatusCode, string(body))
+	}
+
+	var answer bytes.Buffer
+
+	err = readSSEData(resp.Body, func(data []byte) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.Text == "" {
+				continue
+			}
+			answer.WriteString(part.Text)
+			if err := onToken(part.Text); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return answer.String(), err
+	}
+
+	if answer.Len() == 0 {
+		return "", fmt.Errorf("no response generated")
+	}
+
+	return answer.String(), nil
+}
+
+// OpenAICompletionChunk is one server-sent event of a streamed chat completion
+type OpenAICompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// Stream sends a prompt to the chat completion API with streaming enabled and
+// calls onToken with every piece of the answer as it arrives. It returns the
+// full answer once the stream ends.
+func (o *OpenAIService) Stream(ctx context.Context, prompt string, onToken TokenHandler) (string, error) {
+	requestBody := struct {
+		OpenAICompletionRequest
+		Stream bool `json:"stream"`
+	}{
+		OpenAICompletionRequest: o.chatRequest(prompt),
+		Stream:                  true,
+	}
+
+	resp, err := o.post(ctx, "/chat/completions", requestBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer bytes.Buffer
+
+	err = readSSEData(resp.Body, func(data []byte) error {
+		// OpenAI-compatible APIs end the stream with a literal [DONE] marker
+		if bytes.Equal(data, []byte("[DONE]")) {
+			return io.EOF
+		}
+
+		var chunk OpenAICompletionChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+
+		text := chunk.Choices[0].Delta.Content
+		answer.WriteString(text)
+
+		return onToken(text)
+	})
+	if err != nil {
+		return answer.String(), err
+	}
+
+	return answer.String(), nil
+}
+
+// readSSEData calls fn with the data of every event in a server-sent event
+// stream. Multi-line data fields are joined with newlines as the spec requires.
+// fn may return io.EOF to end the stream early without an error.
+func readSSEData(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+
+	var data []byte
+
+	dispatch := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		err := fn(data)
+		data = data[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		switch {
+		case len(line) == 0:
+			// A blank line ends the event
+			if err := dispatch(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		case bytes.HasPrefix(line, []byte("data:")):
+			value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, value...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	// The last event may not be followed by a blank line
+	if err := dispatch(); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package ai
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PromptVariables are the placeholders a prompt template can use, written as
+// {{name}}
+var PromptVariables = []string{"title", "folder", "language", "transcript_language", "date"}
+
+// maxVariableLength caps how much of a value is put into a prompt
+const maxVariableLength = 200
+
+var promptVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_]+)\s*\}\}`)
+
+// UnknownPromptVariables returns the placeholders in the template that aren't
+// among PromptVariables, in the order they first appear
+func UnknownPromptVariables(template string) []string {
+	var unknown []string
+	for _, match := range promptVariable.FindAllStringSubmatch(template, -1) {
+		name := strings.ToLower(match[1])
+		if !slices.Contains(PromptVariables, name) && !slices.Contains(unknown, name) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	return unknown
+}
+
+// RenderPrompt fills in the template's placeholders in a single pass, so text
+// inside a value is never expanded itself. Values are user input such as note
+// titles: they are put on one line, stripped of braces and quotes, and
+// shortened, so they can't break out of the sentence they are used in.
+// Placeholders without a value are left empty. The final full stop is
+// dropped, as the prompt builders add their own.
+func RenderPrompt(template string, values map[string]string) string {
+	prompt := promptVariable.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := strings.ToLower(promptVariable.FindStringSubmatch(placeholder)[1])
+		return cleanPromptValue(values[name])
+	})
+
+	return strings.TrimSpace(strings.TrimRight(prompt, ". \t\r\n"))
+}
+
+// cleanPromptValue makes a value safe to put into a prompt
+func cleanPromptValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case '{', '}', '"', '`':
+			return -1
+		}
+		return r
+	}, value)
+	value = strings.Join(strings.Fields(value), " ")
+
+	if runes := []rune(value); len(runes) > maxVariableLength {
+		value = string(runes[:maxVariableLength])
+	}
+
+	return value
+}
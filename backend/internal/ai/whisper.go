@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WhisperService transcribes audio with OpenAI's Whisper API, or any API
+// compatible with it. It only transcribes; the summary is left to a ChatModel.
+type WhisperService struct {
+	APIKey  string
+	BaseURL string
+	Model   string
+}
+
+// NewWhisperService creates a new Whisper service instance
+func NewWhisperService(apiKey, baseURL string) *WhisperService {
+	return &WhisperService{
+		APIKey:  apiKey,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Model:   "whisper-1",
+	}
+}
+
+// WhisperResponse defines the structure of a verbose_json transcription
+type WhisperResponse struct {
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Text     string  `json:"text"`
+	Segments []struct {
+		ID    int     `json:"id"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+}
+
+// Name identifies the provider in configuration and errors
+func (w *WhisperService) Name() string {
+	return "whisper"
+}
+
+// Languages lists the languages Whisper transcribes
+func (w *WhisperService) Languages() []string {
+	return whisperLanguages
+}
+
+// Transcribe uploads the audio to the transcriptions endpoint and returns the
+// transcript together with its timed segments and the detected language
+func (w *WhisperService) Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcription, error) {
+	if w.APIKey == "" {
+		return nil, fmt.Errorf("Whisper API key not provided")
+	}
+
+	fields := map[string]string{
+		"model":           w.Model,
+		"response_format": "verbose_json",
+	}
+
+	// Whisper detects the language unless it is given one, as ISO-639-1
+	if req.TranscriptLanguage != "" {
+		fields["language"] = BaseLanguage(req.TranscriptLanguage)
+	}
+
+	body, contentType, err := newAudioForm(req.AudioFilePath, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", w.BaseURL+"/audio/transcriptions", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Authorization", "Bearer "+w.APIKey)
+	httpReq.Header.Set("Content-Type", contentType)
+
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status code %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result WhisperResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	transcript := strings.TrimSpace(result.Text)
+	if transcript == "" {
+		return nil, fmt.Errorf("no transcript generated")
+	}
+
+	transcription := &Transcription{
+		Transcript: transcript,
+		Language:   result.Language,
+		Segments:   make([]Segment, 0, len(result.Segments)),
+	}
+
+	for _, segment := range result.Segments {
+		transcription.Segments = append(transcription.Segments, Segment{
+			Start: segment.Start,
+			End:   segment.End,
+			Text:  strings.TrimSpace(segment.Text),
+		})
+	}
+
+	return transcription, nil
+}
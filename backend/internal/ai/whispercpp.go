@@ -0,0 +1,158 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WhisperCppService transcribes audio with a self-hosted whisper.cpp server.
+// It only transcribes; the summary is left to a ChatModel.
+type WhisperCppService struct {
+	BaseURL string
+}
+
+// NewWhisperCppService creates a new whisper.cpp service instance
+func NewWhisperCppService(baseURL string) *WhisperCppService {
+	return &WhisperCppService{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// WhisperCppResponse defines the structure for the verbose_json response from
+// the /inference endpoint
+type WhisperCppResponse struct {
+	Language string `json:"language,omitempty"`
+	Text     string `json:"text"`
+	Segments []struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Name identifies the provider in configuration and errors
+func (w *WhisperCppService) Name() string {
+	return "whispercpp"
+}
+
+// Languages lists the languages whisper.cpp transcribes, which are those of
+// the Whisper models it runs
+func (w *WhisperCppService) Languages() []string {
+	return whisperLanguages
+}
+
+// Transcribe uploads the audio to the server's /inference endpoint and returns
+// the transcript together with its timed segments
+func (w *WhisperCppService) Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcription, error) {
+	if w.BaseURL == "" {
+		return nil, fmt.Errorf("whisper.cpp base URL not provided")
+	}
+
+	// The server transcribes in the language it was started with unless told
+	// to detect it
+	language := "auto"
+	if req.TranscriptLanguage != "" {
+		language = BaseLanguage(req.TranscriptLanguage)
+	}
+
+	body, contentType, err := newAudioForm(req.AudioFilePath, map[string]string{
+		"response_format": "verbose_json",
+		"temperature":     "0.0",
+		"language":        language,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", w.BaseURL+"/inference", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", contentType)
+
+	client := &http.Client{}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API error (status code %d): %s", resp.StatusCode, string(body))
+	}
+
+	var result WhisperCppResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// whisper.cpp reports some failures in the body with a 200 status
+	if result.Error != "" {
+		return nil, fmt.Errorf("whisper.cpp error: %s", result.Error)
+	}
+
+	transcript := strings.TrimSpace(result.Text)
+	if transcript == "" {
+		return nil, fmt.Errorf("no transcript generated")
+	}
+
+	transcription := &Transcription{
+		Transcript: transcript,
+		Language:   result.Language,
+		Segments:   make([]Segment, 0, len(result.Segments)),
+	}
+
+	for _, segment := range result.Segments {
+		transcription.Segments = append(transcription.Segments, Segment{
+			Start: segment.Start,
+			End:   segment.End,
+			Text:  strings.TrimSpace(segment.Text),
+		})
+	}
+
+	return transcription, nil
+}
+
+// newAudioForm builds a multipart form with the audio as its "file" field
+// followed by the given fields. It returns the body and its content type.
+func newAudioForm(audioFilePath string, fields map[string]string) (*bytes.Buffer, string, error) {
+	file, err := os.Open(audioFilePath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioFilePath))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, "", fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, "", fmt.Errorf("failed to write form field: %w", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	return &body, writer.FormDataContentType(), nil
+}
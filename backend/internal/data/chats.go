@@ -0,0 +1,328 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// Who wrote a chat message
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// ChatSession is a conversation over a folder, or over all of the user's
+// notes when it was started without one. A session whose folder was purged
+// is Orphaned and can no longer be asked questions. Older turns are folded
+// into Summary so prompts stay within the model's context; SummarizedThrough
+// is the ID of the last message included in it.
+type ChatSession struct {
+	ID                 int64     `json:"id"`
+	UserID             int64     `json:"user_id"`
+	FolderID           *int64    `json:"folder_id,omitempty"`
+	FolderScoped       bool      `json:"-"`
+	Orphaned           bool      `json:"orphaned"`
+	IncludeDescendants bool      `json:"include_descendants"`
+	Title              string    `json:"title"`
+	Summary            string    `json:"summary,omitempty"`
+	SummarizedThrough  int64     `json:"-"`
+	CreatedAt          time.Time `json:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	Version            int       `json:"version"`
+}
+
+// ChatMessage is a single turn of a chat session. SearchQuery is the
+// standalone query that was used for retrieval when the user asked a
+// follow-up; Sources are the chunks an assistant answer cites.
+type ChatMessage struct {
+	ID          int64           `json:"id"`
+	SessionID   int64           `json:"session_id"`
+	Role        string          `json:"role"`
+	Content     string          `json:"content"`
+	SearchQuery *string         `json:"search_query,omitempty"`
+	Sources     json.RawMessage `json:"sources,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ValidateChatSession checks the fields a user can set on a session
+func ValidateChatSession(v *validator.Validator, session *ChatSession) {
+	v.Check(session.Title != "", "title", "must be provided")
+	v.Check(len(session.Title) <= 100, "title", "must not be more than 100 bytes long")
+}
+
+type ChatModel struct {
+	DB *sql.DB
+}
+
+// InsertSession creates a new chat session
+func (m ChatModel) InsertSession(session *ChatSession) error {
+	query := `
+		INSERT INTO chat_sessions (user_id, folder_id, folder_scoped, include_descendants, title)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version`
+
+	session.FolderScoped = session.FolderID != nil
+
+	args := []interface{}{session.UserID, session.FolderID, session.FolderScoped, session.IncludeDescendants, session.Title}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&session.ID, &session.CreatedAt, &session.UpdatedAt, &session.Version)
+}
+
+// GetSession retrieves a specific chat session by ID
+func (m ChatModel) GetSession(id int64) (*ChatSession, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, folder_id, folder_scoped, include_descendants, title, summary, summarized_through, created_at, updated_at, version
+		FROM chat_sessions
+		WHERE id = $1`
+
+	var session ChatSession
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.FolderID,
+		&session.FolderScoped,
+		&session.IncludeDescendants,
+		&session.Title,
+		&session.Summary,
+		&session.SummarizedThrough,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	session.Orphaned = session.FolderScoped && session.FolderID == nil
+
+	return &session, nil
+}
+
+// GetSessionsForUser returns the user's chat sessions, most recently active first
+func (m ChatModel) GetSessionsForUser(userID int64, filters Filters) ([]*ChatSession, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, user_id, folder_id, folder_scoped, include_descendants, title, summary, summarized_through,
+			created_at, updated_at, version
+		FROM chat_sessions
+		WHERE user_id = $1
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	sessions := []*ChatSession{}
+
+	for rows.Next() {
+		var session ChatSession
+
+		err := rows.Scan(
+			&totalRecords,
+			&session.ID,
+			&session.UserID,
+			&session.FolderID,
+			&session.FolderScoped,
+			&session.IncludeDescendants,
+			&session.Title,
+			&session.Summary,
+			&session.SummarizedThrough,
+			&session.CreatedAt,
+			&session.UpdatedAt,
+			&session.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		session.Orphaned = session.FolderScoped && session.FolderID == nil
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sessions, metadata, nil
+}
+
+// UpdateSummary stores a new rolling summary for the session. It fails with
+// ErrEditConflict if the session changed since it was read.
+func (m ChatModel) UpdateSummary(session *ChatSession) error {
+	query := `
+		UPDATE chat_sessions
+		SET summary = $1, summarized_through = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	args := []interface{}{session.Summary, session.SummarizedThrough, session.ID, session.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&session.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteSession removes a chat session and its messages
+func (m ChatModel) DeleteSession(id int64) error {
+	if id < 1 {
+		return ErrRcordNotFound
+	}
+
+	query := `
+		DELETE FROM chat_sessions
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRcordNotFound
+	}
+
+	return nil
+}
+
+// InsertMessages appends the messages to their session in one transaction,
+// so a question is never stored without its answer, and marks the session
+// as recently active
+func (m ChatModel) InsertMessages(messages ...*ChatMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, message := range messages {
+		err = insertChatMessage(ctx, tx, message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// insertChatMessage inserts the message with q
+func insertChatMessage(ctx context.Context, q Querier, message *ChatMessage) error {
+	query := `
+		WITH inserted AS (
+			INSERT INTO chat_messages (session_id, role, content, search_query, sources)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at
+		), touched AS (
+			UPDATE chat_sessions
+			SET updated_at = NOW()
+			WHERE id = $1
+		)
+		SELECT id, created_at FROM inserted`
+
+	var sources []byte
+	if len(message.Sources) > 0 {
+		sources = message.Sources
+	}
+
+	args := []interface{}{message.SessionID, message.Role, message.Content, message.SearchQuery, sources}
+
+	return q.QueryRowContext(ctx, query, args...).Scan(&message.ID, &message.CreatedAt)
+}
+
+// GetMessages returns the messages of a session with an ID greater than
+// afterID, oldest first. Pass 0 to get the whole conversation.
+func (m ChatModel) GetMessages(sessionID int64, afterID int64) ([]*ChatMessage, error) {
+	query := `
+		SELECT id, session_id, role, content, search_query, sources, created_at
+		FROM chat_messages
+		WHERE session_id = $1 AND id > $2
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, sessionID, afterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*ChatMessage{}
+
+	for rows.Next() {
+		var message ChatMessage
+		var sources []byte
+
+		err := rows.Scan(
+			&message.ID,
+			&message.SessionID,
+			&message.Role,
+			&message.Content,
+			&message.SearchQuery,
+			&sources,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		message.Sources = sources
+		messages = append(messages, &message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/m0hh/Notes/internal/ai"
 	"github.com/pgvector/pgvector-go"
 )
 
@@ -14,8 +15,12 @@ import (
 type NoteTranscriptEmbedding struct {
 	ID              int64           `json:"id"`
 	NoteID          int64           `json:"note_id"`
-	FolderID        int64           `json:"folder_id"`
+	UserID          int64           `json:"user_id"`
+	FolderID        *int64          `json:"folder_id,omitempty"`
+	TranslationID   *int64          `json:"translation_id,omitempty"`
 	TranscriptChunk string          `json:"transcript_chunk"`
+	StartSeconds    *float64        `json:"start_seconds,omitempty"`
+	EndSeconds      *float64        `json:"end_seconds,omitempty"`
 	Embedding       pgvector.Vector `json:"embedding"`
 	CreatedAt       time.Time       `json:"created_at"`
 	UpdatedAt       time.Time       `json:"updated_at"`
@@ -29,11 +34,11 @@ type EmbeddingModel struct {
 // Insert inserts a new transcript chunk and its embedding.
 func (m *EmbeddingModel) Insert(nte *NoteTranscriptEmbedding) error {
 	query := `
-		INSERT INTO note_transcript_embeddings (note_id, folder_id, transcript_chunk, embedding)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO note_transcript_embeddings (note_id, user_id, folder_id, translation_id, transcript_chunk, start_seconds, end_seconds, embedding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at`
 
-	args := []interface{}{nte.NoteID, nte.FolderID, nte.TranscriptChunk, nte.Embedding}
+	args := []interface{}{nte.NoteID, nte.UserID, nte.FolderID, nte.TranslationID, nte.TranscriptChunk, nte.StartSeconds, nte.EndSeconds, nte.Embedding}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -45,14 +50,15 @@ func (m *EmbeddingModel) Insert(nte *NoteTranscriptEmbedding) error {
 	return nil
 }
 
-// DeleteByNoteID deletes all embeddings associated with a specific note_id.
+// DeleteByNoteID deletes the embeddings of a note's own transcript. Those of
+// its translations are kept.
 func (m *EmbeddingModel) DeleteByNoteID(noteID int64) error {
 	if noteID < 1 {
 		return fmt.Errorf("invalid note ID for deletion")
 	}
 	query := `
 		DELETE FROM note_transcript_embeddings
-		WHERE note_id = $1`
+		WHERE note_id = $1 AND translation_id IS NULL`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -70,36 +76,78 @@ func (m *EmbeddingModel) DeleteByNoteID(noteID int64) error {
 	return nil
 }
 
-// GetRelevantChunks retrieves the transcript_chunks for the top limit most similar embeddings
-// to queryEmbedding within a specific folderID, using cosine similarity.
-func (m *EmbeddingModel) GetRelevantChunks(folderID int64, queryEmbedding pgvector.Vector, limit int) ([]string, error) {
+// EmbeddingMetadata describes a stored chunk embedding without its vector
+type EmbeddingMetadata struct {
+	ID              int64     `json:"id"`
+	NoteID          int64     `json:"note_id"`
+	FolderID        *int64    `json:"folder_id,omitempty"`
+	TranslationID   *int64    `json:"translation_id,omitempty"`
+	TranscriptChunk string    `json:"transcript_chunk"`
+	StartSeconds    *float64  `json:"start_seconds,omitempty"`
+	EndSeconds      *float64  `json:"end_seconds,omitempty"`
+	Dimensions      int       `json:"dimensions"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// GetMetadataForUser returns the metadata of every embedding stored for the
+// user's notes
+func (m *EmbeddingModel) GetMetadataForUser(userID int64) ([]*EmbeddingMetadata, error) {
 	query := `
-		SELECT transcript_chunk
+		SELECT id, note_id, folder_id, translation_id, transcript_chunk, start_seconds, end_seconds, vector_dims(embedding), created_at
 		FROM note_transcript_embeddings
-		WHERE folder_id = $1
-		ORDER BY embedding <=> $2
-		LIMIT $3`
+		WHERE user_id = $1
+		ORDER BY note_id, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
-	rows, err := m.DB.Query(query, folderID, queryEmbedding, limit)
+	rows, err := m.DB.QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var chunks []string
+	embeddings := []*EmbeddingMetadata{}
+
 	for rows.Next() {
-		var chunk string
-		if err := rows.Scan(&chunk); err != nil {
+		var e EmbeddingMetadata
+
+		err := rows.Scan(
+			&e.ID,
+			&e.NoteID,
+			&e.FolderID,
+			&e.TranslationID,
+			&e.TranscriptChunk,
+			&e.StartSeconds,
+			&e.EndSeconds,
+			&e.Dimensions,
+			&e.CreatedAt,
+		)
+		if err != nil {
 			return nil, err
 		}
-		chunks = append(chunks, chunk)
+
+		embeddings = append(embeddings, &e)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return chunks, nil
+	return embeddings, nil
+}
+
+// DeleteByTranslationID deletes the embeddings of a translated transcript
+func (m *EmbeddingModel) DeleteByTranslationID(translationID int64) error {
+	query := `
+		DELETE FROM note_transcript_embeddings
+		WHERE translation_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, translationID)
+	return err
 }
 
 // Constants for chunking
@@ -108,13 +156,19 @@ const (
 	overlapWords = 50
 )
 
-// AIServiceEmbedder defines the interface for a service that can generate embeddings
-type AIServiceEmbedder interface {
-	GenerateOpenAIEmbedding(text string) ([]float32, error)
+// transcriptChunk is a piece of a transcript to embed. start and end are nil
+// when the chunk can't be placed in the audio.
+type transcriptChunk struct {
+	text  string
+	start *float64
+	end   *float64
 }
 
 // ProcessAndStoreEmbeddings chunks the transcript, generates embeddings, and stores them.
-func (m *EmbeddingModel) ProcessAndStoreEmbeddings(transcript string, noteID int64, folderID int64, aiService AIServiceEmbedder) error {
+// folderID is nil for notes that are not in a folder. While the segments still
+// match the transcript, chunks follow segment boundaries and record the time
+// range of the audio they cover.
+func (m *EmbeddingModel) ProcessAndStoreEmbeddings(ctx context.Context, transcript string, segments []*TranscriptSegment, noteID int64, userID int64, folderID *int64, embedder ai.Embedder) error {
 	// 1. Delete any previous embeddings for this noteID
 	err := m.DeleteByNoteID(noteID)
 	if err != nil {
@@ -122,59 +176,153 @@ func (m *EmbeddingModel) ProcessAndStoreEmbeddings(transcript string, noteID int
 	}
 
 	// 2. Chunking: Split the transcript into smaller, overlapping text chunks
-	words := strings.Fields(transcript)
-	var chunks []string
-
-	if len(words) == 0 {
-		return nil
+	var chunks []transcriptChunk
+	if SegmentsMatchTranscript(transcript, segments) {
+		chunks = chunkSegments(segments)
+	} else {
+		chunks = chunkWords(transcript)
 	}
 
-	if len(words) <= chunkSize {
-		chunks = append(chunks, transcript)
-	} else {
-		for i := 0; i < len(words); {
-			end := i + chunkSize
-			if end > len(words) {
-				end = len(words)
-			}
-			chunks = append(chunks, strings.Join(words[i:end], " "))
-			if end == len(words) {
-				break
-			}
-			i += (chunkSize - overlapWords)
-			if i >= len(words) {
-				break
-			}
-		}
+	// 3. Embed and store each chunk
+	return m.storeChunks(ctx, chunks, &NoteTranscriptEmbedding{NoteID: noteID, UserID: userID, FolderID: folderID}, embedder)
+}
+
+// ProcessAndStoreTranslationEmbeddings replaces the embeddings of a translated
+// transcript, so questions asked in its language find the note. The chunks
+// can't be placed in the audio since the translation has no segments.
+func (m *EmbeddingModel) ProcessAndStoreTranslationEmbeddings(ctx context.Context, translation *NoteTranslation, userID int64, folderID *int64, embedder ai.Embedder) error {
+	err := m.DeleteByTranslationID(translation.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete previous embeddings for translationID %d: %w", translation.ID, err)
 	}
 
-	if len(chunks) == 0 && len(words) > 0 {
-		chunks = append(chunks, transcript)
+	base := &NoteTranscriptEmbedding{
+		NoteID:        translation.NoteID,
+		UserID:        userID,
+		FolderID:      folderID,
+		TranslationID: &translation.ID,
 	}
 
-	// 3. For each transcript_chunk:
+	return m.storeChunks(ctx, chunkWords(translation.Transcript), base, embedder)
+}
+
+// storeChunks embeds each chunk and stores it with the note, user, folder and
+// translation of base
+func (m *EmbeddingModel) storeChunks(ctx context.Context, chunks []transcriptChunk, base *NoteTranscriptEmbedding, embedder ai.Embedder) error {
+	noteID := base.NoteID
+
 	for _, chunk := range chunks {
-		if strings.TrimSpace(chunk) == "" {
+		if strings.TrimSpace(chunk.text) == "" {
 			continue
 		}
-		embeddingVec, err := aiService.GenerateOpenAIEmbedding(chunk)
+		embeddingVec, err := embedder.Embed(ctx, chunk.text)
 		if err != nil {
-			return fmt.Errorf("failed to generate OpenAI embedding for chunk '%s': %w", chunk[:30], err)
+			return fmt.Errorf("failed to generate %s embedding for chunk '%s': %w", embedder.Name(), chunkPreview(chunk.text), err)
 		}
 
 		nte := &NoteTranscriptEmbedding{
 			NoteID:          noteID,
-			FolderID:        folderID,
-			TranscriptChunk: chunk,
+			UserID:          base.UserID,
+			FolderID:        base.FolderID,
+			TranslationID:   base.TranslationID,
+			TranscriptChunk: chunk.text,
+			StartSeconds:    chunk.start,
+			EndSeconds:      chunk.end,
 		}
 
 		nte.Embedding = pgvector.NewVector(embeddingVec)
 
 		err = m.Insert(nte)
 		if err != nil {
-			return fmt.Errorf("failed to insert note transcript embedding for noteID %d, chunk '%s': %w", noteID, chunk[:30], err)
+			return fmt.Errorf("failed to insert note transcript embedding for noteID %d, chunk '%s': %w", noteID, chunkPreview(chunk.text), err)
 		}
 	}
 
 	return nil
 }
+
+// chunkPreview returns the start of a chunk, at most 30 characters, to
+// identify it in errors
+func chunkPreview(text string) string {
+	runes := []rune(text)
+	return string(runes[:min(len(runes), 30)])
+}
+
+// chunkWords splits a transcript into chunks of chunkSize words, each
+// overlapping the previous one by overlapWords
+func chunkWords(transcript string) []transcriptChunk {
+	words := strings.Fields(transcript)
+	var chunks []transcriptChunk
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	if len(words) <= chunkSize {
+		return []transcriptChunk{{text: transcript}}
+	}
+
+	for i := 0; i < len(words); {
+		end := i + chunkSize
+		if end > len(words) {
+			end = len(words)
+		}
+		chunks = append(chunks, transcriptChunk{text: strings.Join(words[i:end], " ")})
+		if end == len(words) {
+			break
+		}
+		i += (chunkSize - overlapWords)
+		if i >= len(words) {
+			break
+		}
+	}
+
+	return chunks
+}
+
+// chunkSegments groups whole segments into chunks of at most chunkSize words,
+// each repeating up to overlapWords words of segments from the end of the
+// previous one. A segment longer than chunkSize becomes a chunk of its own.
+func chunkSegments(segments []*TranscriptSegment) []transcriptChunk {
+	counts := make([]int, len(segments))
+	for i, segment := range segments {
+		counts[i] = len(strings.Fields(segment.Text))
+	}
+
+	var chunks []transcriptChunk
+
+	for start := 0; start < len(segments); {
+		end, words := start, 0
+		for end < len(segments) && (end == start || words+counts[end] <= chunkSize) {
+			words += counts[end]
+			end++
+		}
+
+		texts := make([]string, 0, end-start)
+		for _, segment := range segments[start:end] {
+			texts = append(texts, strings.TrimSpace(segment.Text))
+		}
+
+		startSeconds, endSeconds := segments[start].Start, segments[end-1].End
+		chunks = append(chunks, transcriptChunk{
+			text:  strings.Join(texts, " "),
+			start: &startSeconds,
+			end:   &endSeconds,
+		})
+
+		if end == len(segments) {
+			break
+		}
+
+		// Back up over the trailing segments that fit in the overlap, always
+		// moving forward by at least one segment
+		next, overlap := end, 0
+		for next-1 > start && overlap+counts[next-1] <= overlapWords {
+			next--
+			overlap += counts[next]
+		}
+		start = next
+	}
+
+	return chunks
+}
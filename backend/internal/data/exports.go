@@ -0,0 +1,170 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// States of a user data export
+const (
+	ExportStatusPending = "pending"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+)
+
+// UserExport is an archive of everything stored about a user, built in the
+// background. FilePath is set once it is ready and the file is deleted when
+// it expires.
+type UserExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type UserExportModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a pending export for the user
+func (m UserExportModel) Insert(export *UserExport) error {
+	query := `
+		INSERT INTO user_exports (user_id)
+		VALUES ($1)
+		RETURNING id, status, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, export.UserID).Scan(&export.ID, &export.Status, &export.CreatedAt)
+}
+
+// Get retrieves an export by ID
+func (m UserExportModel) Get(id int64) (*UserExport, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, status, COALESCE(file_path, ''), error, created_at, completed_at, expires_at
+		FROM user_exports
+		WHERE id = $1`
+
+	var export UserExport
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FilePath,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+// MarkReady records the finished archive and when it expires
+func (m UserExportModel) MarkReady(export *UserExport, filePath string, ttl time.Duration) error {
+	query := `
+		UPDATE user_exports
+		SET status = 'ready', file_path = $2, error = NULL, completed_at = NOW(), expires_at = NOW() + make_interval(secs => $3)
+		WHERE id = $1
+		RETURNING status, completed_at, expires_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, export.ID, filePath, ttl.Seconds()).Scan(&export.Status, &export.CompletedAt, &export.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	export.FilePath = filePath
+
+	return nil
+}
+
+// MarkFailed records that the export could not be built
+func (m UserExportModel) MarkFailed(export *UserExport, exportErr error) error {
+	query := `
+		UPDATE user_exports
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1
+		RETURNING status, error, completed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, export.ID, exportErr.Error()).Scan(&export.Status, &export.Error, &export.CompletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes the exports past their expiry and returns the paths of
+// their archives so the caller can remove them
+func (m UserExportModel) PurgeExpired() ([]string, error) {
+	query := `
+		DELETE FROM user_exports
+		WHERE expires_at < NOW()
+		RETURNING COALESCE(file_path, '')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
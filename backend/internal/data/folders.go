@@ -8,13 +8,14 @@ import (
 )
 
 type Folder struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	ParentID  *int64    `json:"parent_id,omitempty"`
-	UserID    int64     `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *int64     `json:"parent_id,omitempty"`
+	UserID    int64      `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int32      `json:"version"`
 }
 
 type FolderModel struct {
@@ -23,6 +24,14 @@ type FolderModel struct {
 
 // Insert creates a new folder in the database
 func (m FolderModel) Insert(folder *Folder) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertFolder(ctx, m.DB, folder)
+}
+
+// insertFolder creates the folder with q
+func insertFolder(ctx context.Context, q Querier, folder *Folder) error {
 	query := `
 		INSERT INTO folders (name, parent_id, user_id)
 		VALUES ($1, $2, $3)
@@ -30,10 +39,7 @@ func (m FolderModel) Insert(folder *Folder) error {
 
 	args := []interface{}{folder.Name, folder.ParentID, folder.UserID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&folder.ID, &folder.CreatedAt, &folder.UpdatedAt, &folder.Version)
+	return q.QueryRowContext(ctx, query, args...).Scan(&folder.ID, &folder.CreatedAt, &folder.UpdatedAt, &folder.Version)
 }
 
 // Get retrieves a specific folder by ID
@@ -45,7 +51,7 @@ func (m FolderModel) Get(id int64) (*Folder, error) {
 	query := `
 		SELECT id, name, parent_id, user_id, created_at, updated_at, version
 		FROM folders
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var folder Folder
 
@@ -140,7 +146,7 @@ func (m FolderModel) GetAll(userID int64) ([]*Folder, error) {
 	query := `
 		SELECT id, name, parent_id, user_id, created_at, updated_at, version
 		FROM folders
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL
 		ORDER BY name`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -185,7 +191,7 @@ func (m FolderModel) GetChildren(parentID int64, userID int64) ([]*Folder, error
 	query := `
 		SELECT id, name, parent_id, user_id, created_at, updated_at, version
 		FROM folders
-		WHERE parent_id = $1 AND user_id = $2
+		WHERE parent_id = $1 AND user_id = $2 AND deleted_at IS NULL
 		ORDER BY name`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -230,7 +236,7 @@ func (m FolderModel) GetRootFolders(userID int64) ([]*Folder, error) {
 	query := `
 		SELECT id, name, parent_id, user_id, created_at, updated_at, version
 		FROM folders
-		WHERE parent_id IS NULL AND user_id = $1
+		WHERE parent_id IS NULL AND user_id = $1 AND deleted_at IS NULL
 		ORDER BY name`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -269,3 +275,326 @@ func (m FolderModel) GetRootFolders(userID int64) ([]*Folder, error) {
 
 	return folders, nil
 }
+
+// GetSubtreeIDs returns the IDs of the folder and of all its descendant
+// folders that are not in the trash
+func (m FolderModel) GetSubtreeIDs(id int64) ([]int64, error) {
+	// UNION rather than UNION ALL stops the recursion should the tree ever
+	// contain a cycle
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT f.id
+			FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at IS NULL
+		)
+		SELECT id FROM subtree`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var folderID int64
+		if err := rows.Scan(&folderID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, folderID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, ErrRcordNotFound
+	}
+
+	return ids, nil
+}
+
+// SoftDelete moves a folder, its descendant folders and the notes inside them
+// to the trash. Everything is stamped with the same deleted_at so the subtree
+// can be restored as a unit later; notes and folders that were already in the
+// trash keep their own timestamp.
+func (m FolderModel) SoftDelete(folder *Folder) error {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM folders WHERE id = $1 AND deleted_at IS NULL
+			UNION
+			SELECT f.id
+			FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at IS NULL
+		), deleted_notes AS (
+			UPDATE notes
+			SET deleted_at = NOW()
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at IS NULL
+		)
+		UPDATE folders
+		SET deleted_at = NOW()
+		WHERE id IN (SELECT id FROM subtree)
+		RETURNING deleted_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, folder.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		if err := rows.Scan(&folder.DeletedAt); err != nil {
+			return err
+		}
+		found = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrRcordNotFound
+	}
+
+	return nil
+}
+
+// GetDeleted retrieves a folder that is in the trash
+func (m FolderModel) GetDeleted(id int64) (*Folder, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, name, parent_id, user_id, created_at, updated_at, deleted_at, version
+		FROM folders
+		WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	var folder Folder
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&folder.ID,
+		&folder.Name,
+		&folder.ParentID,
+		&folder.UserID,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+		&folder.DeletedAt,
+		&folder.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &folder, nil
+}
+
+// Restore takes a folder out of the trash together with every descendant
+// folder and note that was deleted along with it. If the folder's parent is
+// still in the trash the folder is restored at the top level.
+func (m FolderModel) Restore(folder *Folder) error {
+	query := `
+		WITH RECURSIVE root AS (
+			SELECT id, deleted_at FROM folders WHERE id = $1 AND deleted_at IS NOT NULL
+		), subtree AS (
+			SELECT id FROM root
+			UNION
+			SELECT f.id
+			FROM folders f
+			JOIN subtree s ON f.parent_id = s.id
+			WHERE f.deleted_at = (SELECT deleted_at FROM root)
+		), restored_notes AS (
+			UPDATE notes
+			SET deleted_at = NULL
+			WHERE folder_id IN (SELECT id FROM subtree) AND deleted_at = (SELECT deleted_at FROM root)
+		)
+		UPDATE folders f
+		SET deleted_at = NULL,
+		    parent_id = CASE
+		        WHEN f.id = $1 AND f.parent_id IN (SELECT id FROM folders WHERE deleted_at IS NOT NULL) THEN NULL
+		        ELSE f.parent_id
+		    END,
+		    updated_at = NOW(),
+		    version = version + 1
+		WHERE f.id IN (SELECT id FROM subtree)
+		RETURNING f.id, f.parent_id, f.updated_at, f.version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, folder.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var (
+			id        int64
+			parentID  *int64
+			updatedAt time.Time
+			version   int32
+		)
+
+		if err := rows.Scan(&id, &parentID, &updatedAt, &version); err != nil {
+			return err
+		}
+
+		if id == folder.ID {
+			folder.ParentID = parentID
+			folder.UpdatedAt = updatedAt
+			folder.Version = version
+			folder.DeletedAt = nil
+			found = true
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrRcordNotFound
+	}
+
+	return nil
+}
+
+// GetTrash returns the user's trashed folders that were deleted directly,
+// newest first. Descendants that went to the trash with them are not listed.
+func (m FolderModel) GetTrash(userID int64) ([]*Folder, error) {
+	query := `
+		SELECT f.id, f.name, f.parent_id, f.user_id, f.created_at, f.updated_at, f.deleted_at, f.version
+		FROM folders f
+		LEFT JOIN folders p ON p.id = f.parent_id
+		WHERE f.user_id = $1 AND f.deleted_at IS NOT NULL
+		  AND (p.id IS NULL OR p.deleted_at IS DISTINCT FROM f.deleted_at)
+		ORDER BY f.deleted_at DESC, f.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []*Folder{}
+
+	for rows.Next() {
+		var folder Folder
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.Name,
+			&folder.ParentID,
+			&folder.UserID,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+			&folder.DeletedAt,
+			&folder.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, &folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// PurgeDeleted permanently removes the folders that have been in the trash
+// for longer than retention. Notes should be purged first so their audio
+// files can be cleaned up.
+func (m FolderModel) PurgeDeleted(retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM folders
+		WHERE deleted_at < NOW() - make_interval(secs => $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetAllForUser returns every folder the user owns, including those in the
+// trash
+func (m FolderModel) GetAllForUser(userID int64) ([]*Folder, error) {
+	query := `
+		SELECT id, name, parent_id, user_id, created_at, updated_at, deleted_at, version
+		FROM folders
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	folders := []*Folder{}
+
+	for rows.Next() {
+		var folder Folder
+
+		err := rows.Scan(
+			&folder.ID,
+			&folder.Name,
+			&folder.ParentID,
+			&folder.UserID,
+			&folder.CreatedAt,
+			&folder.UpdatedAt,
+			&folder.DeletedAt,
+			&folder.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		folders = append(folders, &folder)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path"
+	"time"
+)
+
+// States of a folder import
+const (
+	ImportStatusPending = "pending"
+	ImportStatusReady   = "ready"
+	ImportStatusFailed  = "failed"
+)
+
+// FolderImport is an uploaded ZIP whose folders and audio files are created
+// in the background. ArchivePath is where the upload is kept until then.
+// HasParent records that the import goes into a folder, which ParentID no
+// longer shows once that folder is purged.
+type FolderImport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	ParentID    *int64     `json:"parent_id,omitempty"`
+	HasParent   bool       `json:"-"`
+	Name        string     `json:"name"`
+	ArchivePath string     `json:"-"`
+	Status      string     `json:"status"`
+	FolderCount int        `json:"folder_count"`
+	NoteCount   int        `json:"note_count"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ImportedFolder is a folder of an import. Path is its directory in the
+// archive: it goes in the folder of its parent directory, or in the import's
+// parent at the top of the archive.
+type ImportedFolder struct {
+	Path string
+	Name string
+}
+
+// ImportedNote is an audio file of an import, already extracted to
+// AudioFilePath, that becomes a note in the folder of its directory Dir
+type ImportedNote struct {
+	Dir           string
+	Title         string
+	AudioFilePath string
+}
+
+type FolderImportModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a pending import for the user together with the job that
+// runs it, so there is never one without the other. The job's payload gets
+// the import's ID.
+func (m FolderImportModel) Insert(folderImport *FolderImport, payload ImportFolderPayload, maxAttempts int) error {
+	query := `
+		INSERT INTO folder_imports (user_id, parent_id, has_parent, name, archive_path)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at`
+
+	folderImport.HasParent = folderImport.ParentID != nil
+
+	args := []interface{}{folderImport.UserID, folderImport.ParentID, folderImport.HasParent, folderImport.Name, folderImport.ArchivePath}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&folderImport.ID, &folderImport.Status, &folderImport.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	payload.ImportID = folderImport.ID
+
+	_, err = enqueueJob(ctx, tx, JobKindImportFolder, payload, maxAttempts)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get retrieves an import by ID
+func (m FolderImportModel) Get(id int64) (*FolderImport, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, parent_id, has_parent, name, archive_path, status, folder_count, note_count, error, created_at, completed_at
+		FROM folder_imports
+		WHERE id = $1`
+
+	var folderImport FolderImport
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&folderImport.ID,
+		&folderImport.UserID,
+		&folderImport.ParentID,
+		&folderImport.HasParent,
+		&folderImport.Name,
+		&folderImport.ArchivePath,
+		&folderImport.Status,
+		&folderImport.FolderCount,
+		&folderImport.NoteCount,
+		&folderImport.Error,
+		&folderImport.CreatedAt,
+		&folderImport.CompletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &folderImport, nil
+}
+
+// Complete creates the import's folders, parents before their children, and a
+// note for each audio file with a job to process it, then marks the import
+// ready. It all happens in one transaction, so a failure leaves nothing
+// behind. process holds the settings of the processing jobs; its NoteID is
+// filled in for each note. It fails with ErrEditConflict if the import is no
+// longer pending.
+func (m FolderImportModel) Complete(folderImport *FolderImport, folders []ImportedFolder, notes []ImportedNote, process ProcessNoteAudioPayload, maxAttempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	folderIDs := map[string]int64{}
+
+	for _, imported := range folders {
+		folder := &Folder{
+			Name:     imported.Name,
+			ParentID: folderImport.ParentID,
+			UserID:   folderImport.UserID,
+		}
+		if dir := path.Dir(imported.Path); dir != "." {
+			id := folderIDs[dir]
+			folder.ParentID = &id
+		}
+
+		err = insertFolder(ctx, tx, folder)
+		if err != nil {
+			return err
+		}
+
+		folderIDs[imported.Path] = folder.ID
+	}
+
+	for _, imported := range notes {
+		folderID := folderIDs[imported.Dir]
+		note := &Note{
+			Title:         imported.Title,
+			AudioFilePath: imported.AudioFilePath,
+			UserID:        folderImport.UserID,
+			FolderID:      &folderID,
+		}
+
+		err = insertNote(ctx, tx, note)
+		if err != nil {
+			return err
+		}
+
+		process.NoteID = note.ID
+
+		_, err = enqueueJob(ctx, tx, JobKindProcessNoteAudio, process, maxAttempts)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE folder_imports
+		SET status = 'ready', folder_count = $2, note_count = $3, error = NULL, completed_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING status, folder_count, note_count, completed_at`
+
+	err = tx.QueryRowContext(ctx, query, folderImport.ID, len(folders), len(notes)).Scan(
+		&folderImport.Status,
+		&folderImport.FolderCount,
+		&folderImport.NoteCount,
+		&folderImport.CompletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// MarkFailed records that the import could not be completed
+func (m FolderImportModel) MarkFailed(folderImport *FolderImport, importErr error) error {
+	query := `
+		UPDATE folder_imports
+		SET status = 'failed', error = $2, completed_at = NOW()
+		WHERE id = $1
+		RETURNING status, error, completed_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, folderImport.ID, importErr.Error()).Scan(&folderImport.Status, &folderImport.Error, &folderImport.CompletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,454 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusDead      = "dead"
+)
+
+const (
+	JobKindProcessNoteAudio  = "process_note_audio"
+	JobKindRegenerateSummary = "regenerate_summary"
+	JobKindEmbedNote         = "embed_note"
+	JobKindSummarizeChat     = "summarize_chat"
+	JobKindExportUserData    = "export_user_data"
+	JobKindTranslateNote     = "translate_note"
+	JobKindImportFolder      = "import_folder"
+)
+
+// ErrNoJobs is returned by Claim when there is no job ready to run
+var ErrNoJobs = errors.New("no jobs available")
+
+// ErrDuplicateJob is returned by Enqueue when the note already has a
+// processing job waiting or running, or the chat a summarize job
+var ErrDuplicateJob = errors.New("a job for the same note or chat is already pending")
+
+// noteProcessingKinds are the job kinds that rewrite a note's content, of
+// which a note has at most one queued or running
+var noteProcessingKinds = []string{JobKindProcessNoteAudio, JobKindRegenerateSummary}
+
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   sql.NullString  `json:"last_error,omitempty"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedAt    sql.NullTime    `json:"locked_at,omitempty"`
+	LockedBy    sql.NullString  `json:"locked_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ProcessNoteAudioPayload is the payload of a JobKindProcessNoteAudio job.
+// Prompt holds the user's own instructions, if any. TranscriptLanguage is the
+// BCP-47 tag of the spoken language, empty to detect it; SummaryLanguage is
+// the tag of the summary, empty to follow the audio. An empty Pipeline means
+// the default one. Reprocess is set when the note was processed before.
+type ProcessNoteAudioPayload struct {
+	NoteID             int64  `json:"note_id"`
+	Prompt             string `json:"prompt"`
+	TranscriptLanguage string `json:"transcript_language,omitempty"`
+	SummaryLanguage    string `json:"summary_language,omitempty"`
+	Pipeline           string `json:"pipeline,omitempty"`
+	Reprocess          bool   `json:"reprocess,omitempty"`
+}
+
+// RegenerateSummaryPayload is the payload of a JobKindRegenerateSummary job.
+// SummaryLanguage is the BCP-47 tag of the summary, empty to follow the
+// transcript.
+type RegenerateSummaryPayload struct {
+	NoteID          int64  `json:"note_id"`
+	Prompt          string `json:"prompt"`
+	SummaryLanguage string `json:"summary_language,omitempty"`
+	Pipeline        string `json:"pipeline,omitempty"`
+}
+
+// EmbedNotePayload is the payload of a JobKindEmbedNote job
+type EmbedNotePayload struct {
+	NoteID int64 `json:"note_id"`
+}
+
+// SummarizeChatPayload is the payload of a JobKindSummarizeChat job
+type SummarizeChatPayload struct {
+	SessionID int64 `json:"session_id"`
+}
+
+// ExportUserDataPayload is the payload of a JobKindExportUserData job
+type ExportUserDataPayload struct {
+	ExportID int64 `json:"export_id"`
+}
+
+// TranslateNotePayload is the payload of a JobKindTranslateNote job. An empty
+// Pipeline means the default one.
+type TranslateNotePayload struct {
+	TranslationID int64  `json:"translation_id"`
+	Pipeline      string `json:"pipeline,omitempty"`
+}
+
+// ImportFolderPayload is the payload of a JobKindImportFolder job. The
+// languages and pipeline are those the imported notes are processed with.
+type ImportFolderPayload struct {
+	ImportID           int64  `json:"import_id"`
+	TranscriptLanguage string `json:"transcript_language,omitempty"`
+	SummaryLanguage    string `json:"summary_language,omitempty"`
+	Pipeline           string `json:"pipeline,omitempty"`
+}
+
+type JobModel struct {
+	DB *sql.DB
+}
+
+// Enqueue inserts a new job that becomes runnable immediately
+func (m JobModel) Enqueue(kind string, payload any, maxAttempts int) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return enqueueJob(ctx, m.DB, kind, payload, maxAttempts)
+}
+
+// EnqueueNoteRun moves the note back to uploaded and queues the job that
+// processes it again, in one transaction. A worker can't pick the job up
+// before the status is reset, and a job refused with ErrDuplicateJob leaves
+// the note's status alone.
+func (m JobModel) EnqueueNoteRun(note *Note, kind string, payload any, maxAttempts int) (*Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	job, err := enqueueJob(ctx, tx, kind, payload, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = updateNoteStatus(ctx, tx, note, NoteStatusUploaded, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// enqueueJob inserts the job with q
+func enqueueJob(ctx context.Context, q Querier, kind string, payload any, maxAttempts int) (*Job, error) {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO jobs (kind, payload, max_attempts)
+		VALUES ($1, $2, $3)
+		RETURNING id, status, attempts, run_at, created_at, updated_at`
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     js,
+		MaxAttempts: maxAttempts,
+	}
+
+	err = q.QueryRowContext(ctx, query, kind, []byte(js), maxAttempts).Scan(
+		&job.ID,
+		&job.Status,
+		&job.Attempts,
+		&job.RunAt,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "jobs_pending_note_processing_idx"`:
+			return nil, ErrDuplicateJob
+		case err.Error() == `pq: duplicate key value violates unique constraint "jobs_pending_chat_summary_idx"`:
+			return nil, ErrDuplicateJob
+		default:
+			return nil, err
+		}
+	}
+
+	return job, nil
+}
+
+// HasPendingForNote reports whether a job that rewrites the note's content is
+// queued or running
+func (m JobModel) HasPendingForNote(noteID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM jobs
+			WHERE (payload->>'note_id')::bigint = $1
+			AND status IN ('queued', 'running')
+			AND kind = ANY($2)
+		)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var pending bool
+	err := m.DB.QueryRowContext(ctx, query, noteID, pq.Array(noteProcessingKinds)).Scan(&pending)
+
+	return pending, err
+}
+
+// Claim locks the oldest due job for the given worker and marks it as running.
+// SKIP LOCKED lets several workers (and several API replicas) poll the same
+// table without blocking on each other or picking the same job twice.
+func (m JobModel) Claim(workerID string) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = NOW(), locked_by = $1, updated_at = NOW()
+		WHERE id = (
+			SELECT id
+			FROM jobs
+			WHERE status = 'queued' AND run_at <= NOW()
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING id, kind, payload, status, attempts, max_attempts, last_error, run_at, locked_at, locked_by, created_at, updated_at`
+
+	var job Job
+	var payload []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, workerID).Scan(
+		&job.ID,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.LockedAt,
+		&job.LockedBy,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNoJobs
+		default:
+			return nil, err
+		}
+	}
+
+	job.Payload = payload
+
+	return &job, nil
+}
+
+// Complete marks a running job as successfully finished
+func (m JobModel) Complete(job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'completed', locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE id = $1
+		RETURNING status, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, job.ID).Scan(&job.Status, &job.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fail records the error of a running job. The job is queued again after the
+// given backoff, or moved to the dead state once it has used all its attempts.
+func (m JobModel) Fail(job *Job, jobErr error, backoff time.Duration) error {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'queued' END,
+		    last_error = $2,
+		    run_at = NOW() + make_interval(secs => $3),
+		    locked_at = NULL,
+		    locked_by = NULL,
+		    updated_at = NOW()
+		WHERE id = $1
+		RETURNING status, last_error, run_at, updated_at`
+
+	args := []interface{}{job.ID, jobErr.Error(), backoff.Seconds()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&job.Status, &job.LastError, &job.RunAt, &job.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Release queues a running job again straight away without counting the
+// attempt, for jobs interrupted by a shutdown rather than failing
+func (m JobModel) Release(job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'queued', attempts = GREATEST(attempts - 1, 0), run_at = NOW(),
+		    locked_at = NULL, locked_by = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+		RETURNING status, attempts, run_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, job.ID).Scan(&job.Status, &job.Attempts, &job.RunAt, &job.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RequeueStale puts back jobs whose worker has held them for longer than the
+// lease, which happens when a process dies in the middle of a job. It returns
+// how many were requeued and the jobs that were moved to the dead state
+// instead, as nothing else will record their failure.
+func (m JobModel) RequeueStale(lease time.Duration) (int64, []*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'queued' END,
+		    last_error = 'worker lease expired',
+		    locked_at = NULL,
+		    locked_by = NULL,
+		    updated_at = NOW()
+		WHERE status = 'running' AND locked_at < NOW() - make_interval(secs => $1)
+		RETURNING id, kind, payload, status, attempts, max_attempts, last_error, run_at, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, lease.Seconds())
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var requeued int64
+	dead := []*Job{}
+
+	for rows.Next() {
+		var job Job
+		var payload []byte
+
+		err := rows.Scan(
+			&job.ID,
+			&job.Kind,
+			&payload,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.LastError,
+			&job.RunAt,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		job.Payload = payload
+
+		if job.Status == JobStatusDead {
+			dead = append(dead, &job)
+		} else {
+			requeued++
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	return requeued, dead, nil
+}
+
+// Get retrieves a specific job by ID
+func (m JobModel) Get(id int64) (*Job, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, kind, payload, status, attempts, max_attempts, last_error, run_at, locked_at, locked_by, created_at, updated_at
+		FROM jobs
+		WHERE id = $1`
+
+	var job Job
+	var payload []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.ID,
+		&job.Kind,
+		&payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.LastError,
+		&job.RunAt,
+		&job.LockedAt,
+		&job.LockedBy,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	job.Payload = payload
+
+	return &job, nil
+}
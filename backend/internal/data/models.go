@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 )
@@ -14,22 +15,46 @@ var (
 	ErrFKConflict       = errors.New("Foriegn Key conflicr")
 )
 
+// Querier runs queries on the database or inside a transaction, so a query
+// can be shared by a model method and a transaction that spans models
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Models struct {
-	Tokens     TokenModel
-	Users      UserModel
-	Notes      NoteModel
-	Folders    FolderModel
-	Embeddings EmbeddingModel
-	SocialAuth SocialUsersModel
+	Tokens       TokenModel
+	Users        UserModel
+	Notes        NoteModel
+	Folders      FolderModel
+	Embeddings   EmbeddingModel
+	SocialAuth   SocialUsersModel
+	Jobs         JobModel
+	Revisions    NoteRevisionModel
+	Chats        ChatModel
+	Segments     TranscriptSegmentModel
+	Exports      UserExportModel
+	Translations NoteTranslationModel
+	Templates    PromptTemplateModel
+	Imports      FolderImportModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Tokens:     TokenModel{DB: db},
-		Users:      UserModel{DB: db},
-		Notes:      NoteModel{DB: db},
-		Folders:    FolderModel{DB: db},
-		Embeddings: EmbeddingModel{DB: db},
-		SocialAuth: SocialUsersModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Users:        UserModel{DB: db},
+		Notes:        NoteModel{DB: db},
+		Folders:      FolderModel{DB: db},
+		Embeddings:   EmbeddingModel{DB: db},
+		SocialAuth:   SocialUsersModel{DB: db},
+		Jobs:         JobModel{DB: db},
+		Revisions:    NoteRevisionModel{DB: db},
+		Chats:        ChatModel{DB: db},
+		Segments:     TranscriptSegmentModel{DB: db},
+		Exports:      UserExportModel{DB: db},
+		Translations: NoteTranslationModel{DB: db},
+		Templates:    PromptTemplateModel{DB: db},
+		Imports:      FolderImportModel{DB: db},
 	}
 }
@@ -10,16 +10,60 @@ import (
 )
 
 type Note struct {
-	ID            int64          `json:"id"`
-	Title         string         `json:"title"`
-	AudioFilePath string         `json:"audio_file_path"`
-	Transcript    sql.NullString `json:"transcript,omitempty"`
-	Summary       sql.NullString `json:"summary,omitempty"`
-	CreatedAt     time.Time      `json:"created_at"`
-	UpdatedAt     time.Time      `json:"updated_at"`
-	UserID        int64          `json:"user_id"`
-	FolderID      *int64         `json:"folder_id,omitempty"`
-	Version       int            `json:"-"`
+	ID             int64          `json:"id"`
+	Title          string         `json:"title"`
+	AudioFilePath  string         `json:"audio_file_path"`
+	Transcript     sql.NullString `json:"transcript,omitempty"`
+	Summary        sql.NullString `json:"summary,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	UserID         int64          `json:"user_id"`
+	FolderID       *int64         `json:"folder_id,omitempty"`
+	Status         string         `json:"status"`
+	StatusError    *string        `json:"status_error,omitempty"`
+	TranscribingAt *time.Time     `json:"transcribing_at,omitempty"`
+	SummarizingAt  *time.Time     `json:"summarizing_at,omitempty"`
+	EmbeddingAt    *time.Time     `json:"embedding_at,omitempty"`
+	ReadyAt        *time.Time     `json:"ready_at,omitempty"`
+	FailedAt       *time.Time     `json:"failed_at,omitempty"`
+	Language       *string        `json:"language,omitempty"`
+	DeletedAt      *time.Time     `json:"deleted_at,omitempty"`
+	Version        int            `json:"-"`
+}
+
+// NoteContent is the part of a note the processing pipeline writes. The
+// pipeline only overwrites content that is still the one it read.
+type NoteContent struct {
+	Transcript sql.NullString
+	Summary    sql.NullString
+}
+
+// Content returns the note's transcript and summary
+func (n *Note) Content() NoteContent {
+	return NoteContent{Transcript: n.Transcript, Summary: n.Summary}
+}
+
+// Processing stages a note goes through after its audio is uploaded. A note
+// is retrying, with the error in StatusError, while its job waits to run
+// again after a failed attempt.
+const (
+	NoteStatusUploaded     = "uploaded"
+	NoteStatusTranscribing = "transcribing"
+	NoteStatusSummarizing  = "summarizing"
+	NoteStatusEmbedding    = "embedding"
+	NoteStatusRetrying     = "retrying"
+	NoteStatusReady        = "ready"
+	NoteStatusFailed       = "failed"
+)
+
+var NoteStatuses = []string{
+	NoteStatusUploaded,
+	NoteStatusTranscribing,
+	NoteStatusSummarizing,
+	NoteStatusEmbedding,
+	NoteStatusRetrying,
+	NoteStatusReady,
+	NoteStatusFailed,
 }
 
 // ValidateTitle checks that the title is not empty and not too long
@@ -33,17 +77,22 @@ type NoteModel struct {
 }
 
 func (m NoteModel) Insert(note *Note) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertNote(ctx, m.DB, note)
+}
+
+// insertNote creates the note with q
+func insertNote(ctx context.Context, q Querier, note *Note) error {
 	query := `
 		INSERT INTO notes (title, audio_file_path, user_id, folder_id) 
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
+		RETURNING id, created_at, status, version`
 
 	args := []interface{}{note.Title, note.AudioFilePath, note.UserID, note.FolderID}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&note.ID, &note.CreatedAt, &note.Version)
+	return q.QueryRowContext(ctx, query, args...).Scan(&note.ID, &note.CreatedAt, &note.Status, &note.Version)
 }
 
 func (m NoteModel) Get(id int64) (*Note, error) {
@@ -52,9 +101,10 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 	}
 
 	query := `
-		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id, version
+		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id,
+			status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at, language, version
 		FROM notes
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	var note Note
 
@@ -71,6 +121,14 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 		&note.UpdatedAt,
 		&note.UserID,
 		&note.FolderID,
+		&note.Status,
+		&note.StatusError,
+		&note.TranscribingAt,
+		&note.SummarizingAt,
+		&note.EmbeddingAt,
+		&note.ReadyAt,
+		&note.FailedAt,
+		&note.Language,
 		&note.Version,
 	)
 
@@ -86,17 +144,23 @@ func (m NoteModel) Get(id int64) (*Note, error) {
 	return &note, nil
 }
 
-func (m NoteModel) UpdateTranscript(note *Note) error {
+// UpdateTranscript saves the transcript and spoken language the pipeline made.
+// It fails with ErrEditConflict if the note's content is no longer previous,
+// that is if the user changed it since the pipeline read it. Changes that
+// leave the content alone, such as moving the note, don't conflict.
+func (m NoteModel) UpdateTranscript(note *Note, previous NoteContent) error {
 	query := `
 		UPDATE notes
-		SET transcript = $1, updated_at = NOW(), version = version + 1
-		WHERE id = $2 AND version = $3
+		SET transcript = $1, language = $2, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND transcript IS NOT DISTINCT FROM $4 AND summary IS NOT DISTINCT FROM $5
 		RETURNING version`
 
 	args := []interface{}{
 		note.Transcript,
+		note.Language,
 		note.ID,
-		note.Version,
+		previous.Transcript,
+		previous.Summary,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -115,17 +179,20 @@ func (m NoteModel) UpdateTranscript(note *Note) error {
 	return nil
 }
 
-func (m NoteModel) UpdateSummary(note *Note) error {
+// UpdateSummary saves the summary the pipeline made. Like UpdateTranscript,
+// it fails with ErrEditConflict if the note's content is no longer previous.
+func (m NoteModel) UpdateSummary(note *Note, previous NoteContent) error {
 	query := `
 		UPDATE notes
 		SET summary = $1, updated_at = NOW(), version = version + 1
-		WHERE id = $2 AND version = $3
+		WHERE id = $2 AND transcript IS NOT DISTINCT FROM $3 AND summary IS NOT DISTINCT FROM $4
 		RETURNING version`
 
 	args := []interface{}{
 		note.Summary,
 		note.ID,
-		note.Version,
+		previous.Transcript,
+		previous.Summary,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -144,13 +211,53 @@ func (m NoteModel) UpdateSummary(note *Note) error {
 	return nil
 }
 
-// UpdateFolder changes the folder for a note
-func (m NoteModel) UpdateFolder(note *Note) error {
+// Update saves the user-editable fields of a note (title, transcript and summary)
+func (m NoteModel) Update(note *Note) error {
 	query := `
 		UPDATE notes
-		SET folder_id = $1, updated_at = NOW(), version = version + 1
-		WHERE id = $2 AND version = $3
-		RETURNING version`
+		SET title = $1, transcript = $2, summary = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING updated_at, version`
+
+	args := []interface{}{
+		note.Title,
+		note.Transcript,
+		note.Summary,
+		note.ID,
+		note.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&note.UpdatedAt, &note.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateFolder changes the folder for a note. The note's embeddings are moved
+// in the same statement so folder queries never see stale chunks.
+func (m NoteModel) UpdateFolder(note *Note) error {
+	query := `
+		WITH moved AS (
+			UPDATE notes
+			SET folder_id = $1, updated_at = NOW(), version = version + 1
+			WHERE id = $2 AND version = $3
+			RETURNING id, version
+		), moved_chunks AS (
+			UPDATE note_transcript_embeddings
+			SET folder_id = $1, updated_at = NOW()
+			WHERE note_id IN (SELECT id FROM moved)
+		)
+		SELECT version FROM moved`
 
 	args := []interface{}{
 		note.FolderID,
@@ -174,19 +281,73 @@ func (m NoteModel) UpdateFolder(note *Note) error {
 	return nil
 }
 
-// GetAll returns all notes for a specific user
-func (m NoteModel) GetAll(userID int64, filters Filters) ([]*Note, error) {
+// UpdateStatus moves a note to a processing stage and stamps the time it
+// entered that stage. A nil statusErr clears any previous error. The version is
+// left alone so background progress never conflicts with user edits.
+func (m NoteModel) UpdateStatus(note *Note, status string, statusErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return updateNoteStatus(ctx, m.DB, note, status, statusErr)
+}
+
+// updateNoteStatus records the processing stage with q
+func updateNoteStatus(ctx context.Context, q Querier, note *Note, status string, statusErr error) error {
+	query := `
+		UPDATE notes
+		SET status = $1,
+		    status_error = $2,
+		    transcribing_at = CASE WHEN $1 = 'transcribing' THEN NOW() ELSE transcribing_at END,
+		    summarizing_at = CASE WHEN $1 = 'summarizing' THEN NOW() ELSE summarizing_at END,
+		    embedding_at = CASE WHEN $1 = 'embedding' THEN NOW() ELSE embedding_at END,
+		    ready_at = CASE WHEN $1 = 'ready' THEN NOW() ELSE ready_at END,
+		    failed_at = CASE WHEN $1 = 'failed' THEN NOW() ELSE failed_at END
+		WHERE id = $3
+		RETURNING status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at`
+
+	var errMessage *string
+	if statusErr != nil {
+		msg := statusErr.Error()
+		errMessage = &msg
+	}
+
+	args := []interface{}{status, errMessage, note.ID}
+
+	err := q.QueryRowContext(ctx, query, args...).Scan(
+		&note.Status,
+		&note.StatusError,
+		&note.TranscribingAt,
+		&note.SummarizingAt,
+		&note.EmbeddingAt,
+		&note.ReadyAt,
+		&note.FailedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAll returns all notes for a specific user, optionally only those in the given status
+func (m NoteModel) GetAll(userID int64, status string, filters Filters) ([]*Note, error) {
 	query := `
-		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id, version
+		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id,
+			status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at, language, version
 		FROM notes
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL AND ($2 = '' OR status = $2)
 		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3`
+		LIMIT $3 OFFSET $4`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{userID, filters.limit(), filters.offset()}
+	args := []interface{}{userID, status, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -209,6 +370,14 @@ func (m NoteModel) GetAll(userID int64, filters Filters) ([]*Note, error) {
 			&note.UpdatedAt,
 			&note.UserID,
 			&note.FolderID,
+			&note.Status,
+			&note.StatusError,
+			&note.TranscribingAt,
+			&note.SummarizingAt,
+			&note.EmbeddingAt,
+			&note.ReadyAt,
+			&note.FailedAt,
+			&note.Language,
 			&note.Version,
 		)
 
@@ -226,23 +395,24 @@ func (m NoteModel) GetAll(userID int64, filters Filters) ([]*Note, error) {
 	return notes, nil
 }
 
-// GetByFolder returns all notes in a specific folder
-func (m NoteModel) GetByFolder(userID int64, folderID *int64, filters Filters) ([]*Note, error) {
+// GetByFolder returns all notes in a specific folder, optionally only those in the given status
+func (m NoteModel) GetByFolder(userID int64, folderID *int64, status string, filters Filters) ([]*Note, error) {
 	// SQL query that handles both null and non-null folder IDs
 	query := `
-		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id, version
+		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id,
+			status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at, language, version
 		FROM notes
 		WHERE user_id = $1 AND (
 		    ($2::bigint IS NULL AND folder_id IS NULL) OR 
 		    ($2::bigint IS NOT NULL AND folder_id = $2)
-		)
+		) AND deleted_at IS NULL AND ($3 = '' OR status = $3)
 		ORDER BY created_at DESC
-		LIMIT $3 OFFSET $4`
+		LIMIT $4 OFFSET $5`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{userID, folderID, filters.limit(), filters.offset()}
+	args := []interface{}{userID, folderID, status, filters.limit(), filters.offset()}
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -265,6 +435,14 @@ func (m NoteModel) GetByFolder(userID int64, folderID *int64, filters Filters) (
 			&note.UpdatedAt,
 			&note.UserID,
 			&note.FolderID,
+			&note.Status,
+			&note.StatusError,
+			&note.TranscribingAt,
+			&note.SummarizingAt,
+			&note.EmbeddingAt,
+			&note.ReadyAt,
+			&note.FailedAt,
+			&note.Language,
 			&note.Version,
 		)
 
@@ -310,3 +488,276 @@ func (m NoteModel) Delete(id int64) error {
 
 	return nil
 }
+
+// SoftDelete moves a note to the trash. The row and its audio file are kept
+// until the trash is purged.
+func (m NoteModel) SoftDelete(note *Note) error {
+	query := `
+		UPDATE notes
+		SET deleted_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING deleted_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, note.ID).Scan(&note.DeletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetDeleted retrieves a note that is in the trash
+func (m NoteModel) GetDeleted(id int64) (*Note, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id,
+			status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at, language, deleted_at, version
+		FROM notes
+		WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	var note Note
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&note.ID,
+		&note.Title,
+		&note.AudioFilePath,
+		&note.Transcript,
+		&note.Summary,
+		&note.CreatedAt,
+		&note.UpdatedAt,
+		&note.UserID,
+		&note.FolderID,
+		&note.Status,
+		&note.StatusError,
+		&note.TranscribingAt,
+		&note.SummarizingAt,
+		&note.EmbeddingAt,
+		&note.ReadyAt,
+		&note.FailedAt,
+		&note.Language,
+		&note.DeletedAt,
+		&note.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &note, nil
+}
+
+// Restore takes a note out of the trash. If its folder is still in the trash
+// the note is restored unfiled.
+func (m NoteModel) Restore(note *Note) error {
+	query := `
+		WITH restored AS (
+			UPDATE notes
+			SET deleted_at = NULL,
+			    folder_id = CASE
+			        WHEN folder_id IN (SELECT id FROM folders WHERE deleted_at IS NOT NULL) THEN NULL
+			        ELSE folder_id
+			    END,
+			    updated_at = NOW(),
+			    version = version + 1
+			WHERE id = $1 AND deleted_at IS NOT NULL
+			RETURNING id, folder_id, deleted_at, updated_at, version
+		), moved_chunks AS (
+			UPDATE note_transcript_embeddings e
+			SET folder_id = r.folder_id, updated_at = NOW()
+			FROM restored r
+			WHERE e.note_id = r.id AND e.folder_id IS DISTINCT FROM r.folder_id
+		)
+		SELECT folder_id, deleted_at, updated_at, version FROM restored`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, note.ID).Scan(&note.FolderID, &note.DeletedAt, &note.UpdatedAt, &note.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRcordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTrash returns the user's notes that were deleted on their own, newest
+// first. Notes that went to the trash together with their folder are listed
+// through that folder instead.
+func (m NoteModel) GetTrash(userID int64) ([]*Note, error) {
+	query := `
+		SELECT n.id, n.title, n.audio_file_path, n.transcript, n.summary, n.created_at, n.updated_at, n.user_id, n.folder_id,
+			n.status, n.status_error, n.transcribing_at, n.summarizing_at, n.embedding_at, n.ready_at, n.failed_at, n.language, n.deleted_at, n.version
+		FROM notes n
+		LEFT JOIN folders f ON f.id = n.folder_id
+		WHERE n.user_id = $1 AND n.deleted_at IS NOT NULL
+		  AND (f.id IS NULL OR f.deleted_at IS DISTINCT FROM n.deleted_at)
+		ORDER BY n.deleted_at DESC, n.id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*Note{}
+
+	for rows.Next() {
+		var note Note
+
+		err := rows.Scan(
+			&note.ID,
+			&note.Title,
+			&note.AudioFilePath,
+			&note.Transcript,
+			&note.Summary,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.UserID,
+			&note.FolderID,
+			&note.Status,
+			&note.StatusError,
+			&note.TranscribingAt,
+			&note.SummarizingAt,
+			&note.EmbeddingAt,
+			&note.ReadyAt,
+			&note.FailedAt,
+			&note.Language,
+			&note.DeletedAt,
+			&note.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// PurgeDeleted permanently removes the notes that have been in the trash for
+// longer than retention and returns the paths of their audio files so the
+// caller can remove them. Embeddings and revisions go with the rows.
+func (m NoteModel) PurgeDeleted(retention time.Duration) ([]string, error) {
+	query := `
+		DELETE FROM notes
+		WHERE deleted_at < NOW() - make_interval(secs => $1)
+		RETURNING audio_file_path`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// GetAllForUser returns every note the user owns, including those in the
+// trash, oldest first
+func (m NoteModel) GetAllForUser(userID int64) ([]*Note, error) {
+	query := `
+		SELECT id, title, audio_file_path, transcript, summary, created_at, updated_at, user_id, folder_id,
+			status, status_error, transcribing_at, summarizing_at, embedding_at, ready_at, failed_at, language, deleted_at, version
+		FROM notes
+		WHERE user_id = $1
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*Note{}
+
+	for rows.Next() {
+		var note Note
+
+		err := rows.Scan(
+			&note.ID,
+			&note.Title,
+			&note.AudioFilePath,
+			&note.Transcript,
+			&note.Summary,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.UserID,
+			&note.FolderID,
+			&note.Status,
+			&note.StatusError,
+			&note.TranscribingAt,
+			&note.SummarizingAt,
+			&note.EmbeddingAt,
+			&note.ReadyAt,
+			&note.FailedAt,
+			&note.Language,
+			&note.DeletedAt,
+			&note.Version,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, &note)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+// rrfK dampens the weight of the top positions in reciprocal rank fusion.
+// 60 is the value used in the original RRF paper and works well in practice.
+const rrfK = 60
+
+// ChunkQuery describes a hybrid retrieval over the embedded transcript chunks
+// of one user. Empty FolderIDs and NoteIDs search all of the user's notes;
+// otherwise only chunks in those folders or notes are considered.
+type ChunkQuery struct {
+	UserID    int64
+	FolderIDs []int64
+	NoteIDs   []int64
+	Text      string
+	Embedding pgvector.Vector
+	// TopK is the number of fused chunks to return
+	TopK int
+	// Candidates is how many chunks each of the vector and keyword searches
+	// contributes before fusion
+	Candidates int
+	// MinScore drops chunks whose normalized fused score is below it. A chunk
+	// ranked first by both searches scores 1, first in only one scores 0.5.
+	MinScore float64
+}
+
+// RetrievedChunk is a transcript chunk returned by hybrid retrieval. The
+// ranks are nil when the chunk was not found by that search. Similarity is
+// the cosine similarity between the chunk and the query embedding.
+// StartSeconds and EndSeconds locate the chunk in the note's audio when known.
+// Language is set for chunks of a translation of the note.
+type RetrievedChunk struct {
+	ID           int64    `json:"id"`
+	NoteID       int64    `json:"note_id"`
+	NoteTitle    string   `json:"note_title"`
+	Text         string   `json:"text"`
+	Language     *string  `json:"language,omitempty"`
+	StartSeconds *float64 `json:"start_seconds,omitempty"`
+	EndSeconds   *float64 `json:"end_seconds,omitempty"`
+	Score        float64  `json:"score"`
+	Similarity   float64  `json:"similarity"`
+	VectorRank   *int     `json:"vector_rank,omitempty"`
+	KeywordRank  *int     `json:"keyword_rank,omitempty"`
+}
+
+// HybridSearch finds the chunks most relevant to a query by running a pgvector
+// cosine search and a full-text search side by side and merging the two
+// rankings with reciprocal rank fusion. The keyword search matches any of the
+// query's words so that exact names, acronyms and numbers are found even when
+// the embedding misses them.
+func (m *EmbeddingModel) HybridSearch(q ChunkQuery) ([]*RetrievedChunk, error) {
+	if q.TopK < 1 {
+		return nil, errors.New("top-k must be greater than zero")
+	}
+
+	candidates := q.Candidates
+	if candidates < q.TopK {
+		candidates = q.TopK
+	}
+
+	query := `
+		WITH scope AS NOT MATERIALIZED (
+			SELECT e.id, e.embedding, e.chunk_tsv
+			FROM note_transcript_embeddings e
+			JOIN notes n ON n.id = e.note_id
+			WHERE e.user_id = $1 AND n.deleted_at IS NULL
+			  AND (COALESCE(cardinality($8::bigint[]), 0) = 0 OR e.folder_id = ANY($8))
+			  AND (COALESCE(cardinality($9::bigint[]), 0) = 0 OR e.note_id = ANY($9))
+		), vector_hits AS (
+			SELECT id, row_number() OVER (ORDER BY embedding <=> $2) AS rank
+			FROM scope
+			ORDER BY embedding <=> $2
+			LIMIT $4
+		), keyword_hits AS (
+			SELECT s.id, row_number() OVER (ORDER BY ts_rank_cd(s.chunk_tsv, q) DESC, s.id) AS rank
+			FROM scope s, to_tsquery('simple', replace(plainto_tsquery('simple', $3)::text, ' & ', ' | ')) q
+			WHERE s.chunk_tsv @@ q
+			ORDER BY ts_rank_cd(s.chunk_tsv, q) DESC, s.id
+			LIMIT $4
+		), fused AS (
+			SELECT COALESCE(v.id, k.id) AS id, v.rank AS vector_rank, k.rank AS keyword_rank,
+				(COALESCE(1.0 / ($5 + v.rank), 0) + COALESCE(1.0 / ($5 + k.rank), 0)) / (2.0 / ($5 + 1)) AS score
+			FROM vector_hits v
+			FULL OUTER JOIN keyword_hits k ON k.id = v.id
+		)
+		SELECT e.id, e.note_id, n.title, e.transcript_chunk, t.language, e.start_seconds, e.end_seconds, f.score, 1 - (e.embedding <=> $2), f.vector_rank, f.keyword_rank
+		FROM fused f
+		JOIN note_transcript_embeddings e ON e.id = f.id
+		JOIN notes n ON n.id = e.note_id
+		LEFT JOIN note_translations t ON t.id = e.translation_id
+		WHERE f.score >= $6
+		ORDER BY f.score DESC, e.id
+		LIMIT $7`
+
+	args := []interface{}{
+		q.UserID,
+		q.Embedding,
+		q.Text,
+		candidates,
+		rrfK,
+		q.MinScore,
+		q.TopK,
+		pq.Array(q.FolderIDs),
+		pq.Array(q.NoteIDs),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunks := []*RetrievedChunk{}
+
+	for rows.Next() {
+		var chunk RetrievedChunk
+
+		err := rows.Scan(
+			&chunk.ID,
+			&chunk.NoteID,
+			&chunk.NoteTitle,
+			&chunk.Text,
+			&chunk.Language,
+			&chunk.StartSeconds,
+			&chunk.EndSeconds,
+			&chunk.Score,
+			&chunk.Similarity,
+			&chunk.VectorRank,
+			&chunk.KeywordRank,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, &chunk)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,172 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Where a note revision came from. The first processing of a note is recorded
+// with the name of the transcription provider that ran, such as "whisper".
+const (
+	RevisionSourceUserEdit  = "user_edit"
+	RevisionSourceReprocess = "reprocess"
+	RevisionSourceRestore   = "restore"
+)
+
+// NoteRevision is a snapshot of a note's title, transcript and summary taken
+// every time one of them changes
+type NoteRevision struct {
+	ID         int64          `json:"id"`
+	NoteID     int64          `json:"note_id"`
+	Revision   int            `json:"revision"`
+	UserID     *int64         `json:"user_id,omitempty"`
+	Source     string         `json:"source"`
+	Title      string         `json:"title"`
+	Transcript sql.NullString `json:"transcript,omitempty"`
+	Summary    sql.NullString `json:"summary,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type NoteRevisionModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a snapshot of the note as its next revision. userID is nil
+// when the change was made by the processing pipeline. The note's row is
+// locked while the next number is picked, so saves that race each other get
+// consecutive revisions instead of the same one.
+func (m NoteRevisionModel) Insert(note *Note, source string, userID *int64) (*NoteRevision, error) {
+	query := `
+		INSERT INTO note_revisions (note_id, revision, user_id, source, title, transcript, summary)
+		VALUES ($1, (SELECT COALESCE(MAX(revision), 0) + 1 FROM note_revisions WHERE note_id = $1), $2, $3, $4, $5, $6)
+		RETURNING id, revision, created_at`
+
+	rev := &NoteRevision{
+		NoteID:     note.ID,
+		UserID:     userID,
+		Source:     source,
+		Title:      note.Title,
+		Transcript: note.Transcript,
+		Summary:    note.Summary,
+	}
+
+	args := []interface{}{note.ID, userID, source, note.Title, note.Transcript, note.Summary}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT id FROM notes WHERE id = $1 FOR UPDATE`, note.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&rev.ID, &rev.Revision, &rev.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// Get retrieves a single revision of a note
+func (m NoteRevisionModel) Get(noteID int64, revision int) (*NoteRevision, error) {
+	if noteID < 1 || revision < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, note_id, revision, user_id, source, title, transcript, summary, created_at
+		FROM note_revisions
+		WHERE note_id = $1 AND revision = $2`
+
+	var rev NoteRevision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, noteID, revision).Scan(
+		&rev.ID,
+		&rev.NoteID,
+		&rev.Revision,
+		&rev.UserID,
+		&rev.Source,
+		&rev.Title,
+		&rev.Transcript,
+		&rev.Summary,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &rev, nil
+}
+
+// GetAllForNote returns the revisions of a note, newest first
+func (m NoteRevisionModel) GetAllForNote(noteID int64, filters Filters) ([]*NoteRevision, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, note_id, revision, user_id, source, title, transcript, summary, created_at
+		FROM note_revisions
+		WHERE note_id = $1
+		ORDER BY revision DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, noteID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*NoteRevision{}
+
+	for rows.Next() {
+		var rev NoteRevision
+
+		err := rows.Scan(
+			&totalRecords,
+			&rev.ID,
+			&rev.NoteID,
+			&rev.Revision,
+			&rev.UserID,
+			&rev.Source,
+			&rev.Title,
+			&rev.Transcript,
+			&rev.Summary,
+			&rev.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
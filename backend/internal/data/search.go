@@ -0,0 +1,139 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// NoteSearch holds the query and the optional filters of a full-text search
+type NoteSearch struct {
+	Query    string
+	FolderID *int64
+	From     *time.Time
+	To       *time.Time
+	Status   string
+}
+
+// NoteSearchResult is a matching note with its rank and a highlighted snippet
+// of the text around the matched words
+type NoteSearchResult struct {
+	Note     *Note   `json:"note"`
+	Rank     float64 `json:"rank"`
+	Headline string  `json:"headline"`
+}
+
+// ValidateNoteSearch checks the search query and filters
+func ValidateNoteSearch(v *validator.Validator, s NoteSearch) {
+	v.Check(s.Query != "", "q", "must be provided")
+	v.Check(len(s.Query) <= 200, "q", "must not be more than 200 bytes long")
+
+	if s.Status != "" {
+		v.Check(validator.In(s.Status, NoteStatuses...), "status", "invalid status value")
+	}
+
+	if s.From != nil && s.To != nil {
+		v.Check(s.From.Before(*s.To), "to", "must be after from")
+	}
+}
+
+// headlineOptions controls the snippets returned by ts_headline
+const headlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=3, FragmentDelimiter=" … "`
+
+// Search runs a full-text search over the titles, summaries and transcripts
+// of the user's notes. Title matches rank above summary matches, which rank
+// above transcript matches. The query accepts web search syntax: quoted
+// phrases, OR and -excluded words.
+func (m NoteModel) Search(userID int64, search NoteSearch, filters Filters) ([]*NoteSearchResult, Metadata, error) {
+	// Headlines are only generated for the page being returned since they
+	// have to re-parse the full text of every note
+	query := fmt.Sprintf(`
+		WITH matches AS (
+			SELECT count(*) OVER() AS total_records, n.id, n.title, n.audio_file_path, n.transcript, n.summary,
+				n.created_at, n.updated_at, n.user_id, n.folder_id, n.status, n.status_error, n.transcribing_at,
+				n.summarizing_at, n.embedding_at, n.ready_at, n.failed_at, n.language, n.version,
+				ts_rank_cd(n.search_vector, q) AS rank
+			FROM notes n, websearch_to_tsquery('simple', $2) q
+			WHERE n.user_id = $1 AND n.deleted_at IS NULL AND n.search_vector @@ q
+			  AND ($3::bigint IS NULL OR n.folder_id = $3)
+			  AND ($4::timestamptz IS NULL OR n.created_at >= $4)
+			  AND ($5::timestamptz IS NULL OR n.created_at < $5)
+			  AND ($6 = '' OR n.status = $6)
+			ORDER BY %[1]s %[2]s, n.id ASC
+			LIMIT $7 OFFSET $8
+		)
+		SELECT m.total_records, m.id, m.title, m.audio_file_path, m.transcript, m.summary, m.created_at,
+			m.updated_at, m.user_id, m.folder_id, m.status, m.status_error, m.transcribing_at, m.summarizing_at,
+			m.embedding_at, m.ready_at, m.failed_at, m.language, m.version, m.rank,
+			ts_headline('simple', concat_ws(' ', m.summary, m.transcript), q, '%[3]s')
+		FROM matches m, websearch_to_tsquery('simple', $2) q
+		ORDER BY m.%[1]s %[2]s, m.id ASC`, filters.sortColumn(), filters.sortDirection(), headlineOptions)
+
+	args := []interface{}{
+		userID,
+		search.Query,
+		search.FolderID,
+		search.From,
+		search.To,
+		search.Status,
+		filters.limit(),
+		filters.offset(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*NoteSearchResult{}
+
+	for rows.Next() {
+		var note Note
+		var result NoteSearchResult
+
+		err := rows.Scan(
+			&totalRecords,
+			&note.ID,
+			&note.Title,
+			&note.AudioFilePath,
+			&note.Transcript,
+			&note.Summary,
+			&note.CreatedAt,
+			&note.UpdatedAt,
+			&note.UserID,
+			&note.FolderID,
+			&note.Status,
+			&note.StatusError,
+			&note.TranscribingAt,
+			&note.SummarizingAt,
+			&note.EmbeddingAt,
+			&note.ReadyAt,
+			&note.FailedAt,
+			&note.Language,
+			&note.Version,
+			&result.Rank,
+			&result.Headline,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		result.Note = &note
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// TranscriptSegment is a timed stretch of a note's transcript. Start and End
+// are offsets into the note's audio in seconds; Speaker is empty when the
+// transcription provider doesn't label speakers.
+type TranscriptSegment struct {
+	ID       int64   `json:"id"`
+	NoteID   int64   `json:"note_id"`
+	Position int     `json:"position"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Speaker  string  `json:"speaker,omitempty"`
+	Text     string  `json:"text"`
+}
+
+type TranscriptSegmentModel struct {
+	DB *sql.DB
+}
+
+// ReplaceForNote swaps the segments of a note for the given ones, numbering
+// them in order. An empty slice just removes the old segments.
+func (m TranscriptSegmentModel) ReplaceForNote(noteID int64, segments []*TranscriptSegment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM transcript_segments WHERE note_id = $1`, noteID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO transcript_segments (note_id, position, start_seconds, end_seconds, speaker, text)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id`
+
+	for i, segment := range segments {
+		segment.NoteID = noteID
+		segment.Position = i + 1
+
+		args := []interface{}{noteID, segment.Position, segment.Start, segment.End, segment.Speaker, segment.Text}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&segment.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetForNote returns the segments of a note in playback order
+func (m TranscriptSegmentModel) GetForNote(noteID int64) ([]*TranscriptSegment, error) {
+	query := `
+		SELECT id, note_id, position, start_seconds, end_seconds, COALESCE(speaker, ''), text
+		FROM transcript_segments
+		WHERE note_id = $1
+		ORDER BY position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	segments := []*TranscriptSegment{}
+
+	for rows.Next() {
+		var segment TranscriptSegment
+
+		err := rows.Scan(
+			&segment.ID,
+			&segment.NoteID,
+			&segment.Position,
+			&segment.Start,
+			&segment.End,
+			&segment.Speaker,
+			&segment.Text,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		segments = append(segments, &segment)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return segments, nil
+}
+
+// SegmentsMatchTranscript reports whether the segments still spell out the
+// transcript, ignoring whitespace. They stop matching once the transcript is
+// edited or restored from a revision.
+func SegmentsMatchTranscript(transcript string, segments []*TranscriptSegment) bool {
+	if len(segments) == 0 {
+		return false
+	}
+
+	var words []string
+	for _, segment := range segments {
+		words = append(words, strings.Fields(segment.Text)...)
+	}
+
+	return strings.Join(words, " ") == strings.Join(strings.Fields(transcript), " ")
+}
@@ -0,0 +1,218 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/m0hh/Notes/internal/ai"
+	"github.com/m0hh/Notes/internal/validator"
+)
+
+// PromptTemplate is a reusable set of instructions for summarizing a note.
+// Built-in templates have no user and can be used by everyone, but not
+// changed.
+type PromptTemplate struct {
+	ID          int64     `json:"id"`
+	UserID      *int64    `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Body        string    `json:"body"`
+	Builtin     bool      `json:"builtin"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int       `json:"version"`
+}
+
+// UsableBy reports whether the user can summarize notes with the template
+func (t *PromptTemplate) UsableBy(userID int64) bool {
+	return t.UserID == nil || *t.UserID == userID
+}
+
+// ValidatePromptTemplate checks the fields a user can set on a template
+func ValidatePromptTemplate(v *validator.Validator, template *PromptTemplate) {
+	v.Check(template.Name != "", "name", "must be provided")
+	v.Check(len(template.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(template.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(template.Body != "", "body", "must be provided")
+	v.Check(len(template.Body) <= 4000, "body", "must not be more than 4000 bytes long")
+
+	if unknown := ai.UnknownPromptVariables(template.Body); len(unknown) > 0 {
+		v.AddError("body", fmt.Sprintf("uses unknown variables %s; the variables are %s",
+			strings.Join(unknown, ", "), strings.Join(ai.PromptVariables, ", ")))
+	}
+}
+
+type PromptTemplateModel struct {
+	DB *sql.DB
+}
+
+// Insert creates a template owned by the template's user
+func (m PromptTemplateModel) Insert(template *PromptTemplate) error {
+	query := `
+		INSERT INTO prompt_templates (user_id, name, description, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at, version`
+
+	args := []interface{}{template.UserID, template.Name, template.Description, template.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt, &template.Version)
+	if err != nil {
+		return err
+	}
+
+	template.Builtin = template.UserID == nil
+
+	return nil
+}
+
+// Get retrieves a template by ID
+func (m PromptTemplateModel) Get(id int64) (*PromptTemplate, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, user_id, name, description, body, created_at, updated_at, version
+		FROM prompt_templates
+		WHERE id = $1`
+
+	var template PromptTemplate
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&template.ID,
+		&template.UserID,
+		&template.Name,
+		&template.Description,
+		&template.Body,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+		&template.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	template.Builtin = template.UserID == nil
+
+	return &template, nil
+}
+
+// GetAllForUser returns the built-in templates followed by the user's own,
+// each ordered by name
+func (m PromptTemplateModel) GetAllForUser(userID int64) ([]*PromptTemplate, error) {
+	query := `
+		SELECT id, user_id, name, description, body, created_at, updated_at, version
+		FROM prompt_templates
+		WHERE user_id IS NULL OR user_id = $1
+		ORDER BY user_id NULLS FIRST, name, id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []*PromptTemplate{}
+
+	for rows.Next() {
+		var template PromptTemplate
+
+		err := rows.Scan(
+			&template.ID,
+			&template.UserID,
+			&template.Name,
+			&template.Description,
+			&template.Body,
+			&template.CreatedAt,
+			&template.UpdatedAt,
+			&template.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		template.Builtin = template.UserID == nil
+		templates = append(templates, &template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// Update saves the template's name, description and body. It fails with
+// ErrEditConflict if the template changed since it was read.
+func (m PromptTemplateModel) Update(template *PromptTemplate) error {
+	query := `
+		UPDATE prompt_templates
+		SET name = $1, description = $2, body = $3, updated_at = NOW(), version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING updated_at, version`
+
+	args := []interface{}{template.Name, template.Description, template.Body, template.ID, template.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&template.UpdatedAt, &template.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a template
+func (m PromptTemplateModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRcordNotFound
+	}
+
+	query := `
+		DELETE FROM prompt_templates
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRcordNotFound
+	}
+
+	return nil
+}
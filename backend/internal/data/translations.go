@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// States of a note translation
+const (
+	TranslationStatusPending = "pending"
+	TranslationStatusReady   = "ready"
+	TranslationStatusFailed  = "failed"
+)
+
+// NoteTranslation is a note's transcript and summary translated into another
+// language. SourceVersion is the version of the note that was translated, so
+// the translation is stale once the note has changed since. Embed asks for
+// the translated transcript to be embedded for retrieval.
+type NoteTranslation struct {
+	ID            int64     `json:"id"`
+	NoteID        int64     `json:"note_id"`
+	Language      string    `json:"language"`
+	Status        string    `json:"status"`
+	Transcript    string    `json:"transcript,omitempty"`
+	Summary       string    `json:"summary,omitempty"`
+	Error         *string   `json:"error,omitempty"`
+	Embed         bool      `json:"embed"`
+	SourceVersion int       `json:"source_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Version       int       `json:"-"`
+}
+
+type NoteTranslationModel struct {
+	DB *sql.DB
+}
+
+// Request creates a pending translation of the note into its language, or
+// starts over an existing translation into the same language
+func (m NoteTranslationModel) Request(translation *NoteTranslation) error {
+	query := `
+		INSERT INTO note_translations (note_id, language, embed, source_version)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (note_id, language) DO UPDATE
+		SET status = 'pending', transcript = NULL, summary = NULL, error = NULL,
+		    embed = EXCLUDED.embed, source_version = EXCLUDED.source_version,
+		    updated_at = NOW(), version = note_translations.version + 1
+		RETURNING id, status, created_at, updated_at, version`
+
+	args := []interface{}{translation.NoteID, translation.Language, translation.Embed, translation.SourceVersion}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&translation.ID,
+		&translation.Status,
+		&translation.CreatedAt,
+		&translation.UpdatedAt,
+		&translation.Version,
+	)
+	if err != nil {
+		return err
+	}
+
+	translation.Transcript = ""
+	translation.Summary = ""
+	translation.Error = nil
+
+	return nil
+}
+
+// Get retrieves a translation by ID
+func (m NoteTranslationModel) Get(id int64) (*NoteTranslation, error) {
+	if id < 1 {
+		return nil, ErrRcordNotFound
+	}
+
+	query := `
+		SELECT id, note_id, language, status, COALESCE(transcript, ''), COALESCE(summary, ''), error, embed,
+			source_version, created_at, updated_at, version
+		FROM note_translations
+		WHERE id = $1`
+
+	return m.getOne(query, id)
+}
+
+// GetForNote retrieves the translation of a note into the given language
+func (m NoteTranslationModel) GetForNote(noteID int64, language string) (*NoteTranslation, error) {
+	query := `
+		SELECT id, note_id, language, status, COALESCE(transcript, ''), COALESCE(summary, ''), error, embed,
+			source_version, created_at, updated_at, version
+		FROM note_translations
+		WHERE note_id = $1 AND language = $2`
+
+	return m.getOne(query, noteID, language)
+}
+
+func (m NoteTranslationModel) getOne(query string, args ...interface{}) (*NoteTranslation, error) {
+	var translation NoteTranslation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&translation.ID,
+		&translation.NoteID,
+		&translation.Language,
+		&translation.Status,
+		&translation.Transcript,
+		&translation.Summary,
+		&translation.Error,
+		&translation.Embed,
+		&translation.SourceVersion,
+		&translation.CreatedAt,
+		&translation.UpdatedAt,
+		&translation.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRcordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &translation, nil
+}
+
+// GetAllForNote returns the translations of a note ordered by language. The
+// translated text is left out; it is fetched one translation at a time.
+func (m NoteTranslationModel) GetAllForNote(noteID int64) ([]*NoteTranslation, error) {
+	query := `
+		SELECT id, note_id, language, status, error, embed, source_version, created_at, updated_at, version
+		FROM note_translations
+		WHERE note_id = $1
+		ORDER BY language`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := []*NoteTranslation{}
+
+	for rows.Next() {
+		var translation NoteTranslation
+
+		err := rows.Scan(
+			&translation.ID,
+			&translation.NoteID,
+			&translation.Language,
+			&translation.Status,
+			&translation.Error,
+			&translation.Embed,
+			&translation.SourceVersion,
+			&translation.CreatedAt,
+			&translation.UpdatedAt,
+			&translation.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		translations = append(translations, &translation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return translations, nil
+}
+
+// MarkReady stores the translated text. It fails with ErrEditConflict if the
+// translation was requested again since it was read.
+func (m NoteTranslationModel) MarkReady(translation *NoteTranslation) error {
+	query := `
+		UPDATE note_translations
+		SET status = 'ready', transcript = $1, summary = NULLIF($2, ''), error = NULL, updated_at = NOW(), version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING status, updated_at, version`
+
+	args := []interface{}{translation.Transcript, translation.Summary, translation.ID, translation.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&translation.Status, &translation.UpdatedAt, &translation.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MarkFailed records why the translation could not be made. It fails with
+// ErrEditConflict if the translation was requested again since it was read.
+func (m NoteTranslationModel) MarkFailed(translation *NoteTranslation, translationErr error) error {
+	query := `
+		UPDATE note_translations
+		SET status = 'failed', error = $1, updated_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING status, error, updated_at, version`
+
+	args := []interface{}{translationErr.Error(), translation.ID, translation.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&translation.Status, &translation.Error, &translation.UpdatedAt, &translation.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes a translation together with its embeddings
+func (m NoteTranslationModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRcordNotFound
+	}
+
+	query := `
+		DELETE FROM note_translations
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRcordNotFound
+	}
+
+	return nil
+}
@@ -29,6 +29,7 @@ type User struct {
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
 	Role      string    `json:"role"`
+	Pipeline  string    `json:"pipeline,omitempty"`
 }
 
 func (u *User) IsAnonymous() bool {
@@ -120,7 +121,7 @@ func (m UserModel) Insert(user *User) error {
 }
 
 func (m UserModel) RetrieveByEmail(email string) (*User, error) {
-	stmt := `SELECT id, name, email,version,role, activated, created_at, password_hash
+	stmt := `SELECT id, name, email,version,role, activated, created_at, password_hash, pipeline
 	FROM users WHERE email = $1`
 
 	var user User
@@ -136,6 +137,7 @@ func (m UserModel) RetrieveByEmail(email string) (*User, error) {
 		&user.Activated,
 		&user.CreatedAt,
 		&user.Password.hash,
+		&user.Pipeline,
 	)
 
 	if err != nil {
@@ -155,8 +157,8 @@ func (m UserModel) RetrieveByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
         UPDATE users 
-        SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET name = $1, email = $2, password_hash = $3, activated = $4, pipeline = $5, version = version + 1
+        WHERE id = $6 AND version = $7
         RETURNING version`
 
 	args := []interface{}{
@@ -164,6 +166,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.Pipeline,
 		user.Id,
 		user.Version,
 	}
@@ -190,7 +193,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.role
+        SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.role, users.pipeline
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -214,6 +217,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Activated,
 		&user.Version,
 		&user.Role,
+		&user.Pipeline,
 	)
 	if err != nil {
 		switch {
@@ -251,7 +255,7 @@ func (m UserModel) Authenticate(ctx context.Context, email, password string) (*U
 }
 
 func (m UserModel) Retrieve(id int64) (*User, error) {
-	stmt := `SELECT id, name, email, version, role, activated, created_at, password_hash
+	stmt := `SELECT id, name, email, version, role, activated, created_at, password_hash, pipeline
 	FROM users WHERE id = $1`
 
 	var user User
@@ -267,6 +271,7 @@ func (m UserModel) Retrieve(id int64) (*User, error) {
 		&user.Activated,
 		&user.CreatedAt,
 		&user.Password.hash,
+		&user.Pipeline,
 	)
 
 	if err != nil {
@@ -280,3 +285,58 @@ func (m UserModel) Retrieve(id int64) (*User, error) {
 
 	return &user, nil
 }
+
+// Delete removes the user and everything they own. Notes are deleted first so
+// the paths of their audio files can be returned for the caller to remove;
+// tokens, folders, chats and the rest go with the user row.
+func (m UserModel) Delete(id int64) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `DELETE FROM notes WHERE user_id = $1 RETURNING audio_file_path`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrRcordNotFound
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,185 @@
+package diff
+
+import (
+	"strings"
+)
+
+// Operation types of a diff
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// maxEditDistance bounds the work done for very different texts. Past it the
+// whole changed middle is reported as one deletion and one insertion.
+const maxEditDistance = 1000
+
+// Op is a run of consecutive words that are equal in both texts, only in the
+// new text (insert) or only in the old text (delete)
+type Op struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type edit struct {
+	typ  string
+	word string
+}
+
+// Words returns the word-level diff that turns a into b
+func Words(a, b string) []Op {
+	return coalesce(diffWords(strings.Fields(a), strings.Fields(b)))
+}
+
+func diffWords(a, b []string) []edit {
+	// Strip the common prefix and suffix so the search only covers the change
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var edits []edit
+	for _, word := range a[:prefix] {
+		edits = append(edits, edit{Equal, word})
+	}
+
+	edits = append(edits, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+
+	for _, word := range a[len(a)-suffix:] {
+		edits = append(edits, edit{Equal, word})
+	}
+
+	return edits
+}
+
+// myers finds a shortest edit script with Myers' O(ND) algorithm. Only the
+// part of V reachable at each step is kept for backtracking, so memory grows
+// with the square of the edit distance rather than the text length.
+func myers(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	limit := n + m
+	if limit > maxEditDistance {
+		limit = maxEditDistance
+	}
+
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+
+	return replace(a, b)
+}
+
+func backtrack(trace [][]int, a, b []string) []edit {
+	x, y := len(a), len(b)
+	var reversed []edit
+
+	at := func(snapshot []int, d, k int) int {
+		i := k + d
+		if i < 0 || i >= len(snapshot) {
+			return 0
+		}
+		return snapshot[i]
+	}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(snapshot, d, k-1) < at(snapshot, d, k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := at(snapshot, d, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, edit{Equal, a[x-1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, edit{Insert, b[y-1]})
+			} else {
+				reversed = append(reversed, edit{Delete, a[x-1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	edits := make([]edit, len(reversed))
+	for i := range reversed {
+		edits[i] = reversed[len(reversed)-1-i]
+	}
+
+	return edits
+}
+
+func replace(a, b []string) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, word := range a {
+		edits = append(edits, edit{Delete, word})
+	}
+	for _, word := range b {
+		edits = append(edits, edit{Insert, word})
+	}
+
+	return edits
+}
+
+// coalesce joins consecutive edits of the same type into a single Op
+func coalesce(edits []edit) []Op {
+	ops := []Op{}
+
+	for _, e := range edits {
+		if len(ops) > 0 && ops[len(ops)-1].Type == e.typ {
+			ops[len(ops)-1].Text += " " + e.word
+			continue
+		}
+		ops = append(ops, Op{Type: e.typ, Text: e.word})
+	}
+
+	return ops
+}
@@ -0,0 +1,99 @@
+package events
+
+import (
+	"sync"
+)
+
+// Event types published while a note is processed
+const (
+	TypeStatus     = "status"
+	TypeTranscript = "transcript"
+	TypeSummary    = "summary"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind before
+// further events are dropped for it
+const subscriberBuffer = 32
+
+// Event is a change to one of a user's notes
+type Event struct {
+	Type   string `json:"type"`
+	NoteID int64  `json:"note_id"`
+	UserID int64  `json:"-"`
+	Data   any    `json:"data"`
+}
+
+// Subscription receives the events of a single user on C until it is closed
+type Subscription struct {
+	C      chan Event
+	userID int64
+}
+
+// Hub is an in-process pub/sub hub that fans note events out to the
+// subscribers of the note's owner. Only subscribers connected to the same
+// process receive an event.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int64]map[*Subscription]struct{}
+}
+
+// New creates an empty hub
+func New() *Hub {
+	return &Hub{
+		subscribers: make(map[int64]map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a new subscription for all events of the given user
+func (h *Hub) Subscribe(userID int64) *Subscription {
+	sub := &Subscription{
+		C:      make(chan Event, subscriberBuffer),
+		userID: userID,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+
+	return sub
+}
+
+// Unsubscribe removes the subscription and closes its channel
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs, ok := h.subscribers[sub.userID]
+	if !ok {
+		return
+	}
+
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.userID)
+	}
+
+	close(sub.C)
+}
+
+// Publish delivers the event to every subscriber of its user. It never blocks:
+// a subscriber whose buffer is full misses the event.
+func (h *Hub) Publish(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for sub := range h.subscribers[event.UserID] {
+		select {
+		case sub.C <- event:
+		default:
+		}
+	}
+}
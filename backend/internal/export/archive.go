@@ -0,0 +1,124 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ArchiveAudio is an audio file in an imported archive. Dir is the folder
+// path it goes in and Title the title of its note.
+type ArchiveAudio struct {
+	File  *zip.File
+	Dir   string
+	Title string
+}
+
+// Archive is the content of an imported ZIP. Dirs are the folder paths to
+// create, sorted so parents come before their children.
+type Archive struct {
+	Dirs  []string
+	Audio []ArchiveAudio
+}
+
+// ReadArchive lists the folders and audio files in a ZIP, either a folder
+// archive exported by the API or a plain ZIP of audio files. When there are
+// audio files at the top of the archive, everything is placed in a folder
+// called rootName. Notes exported with their JSON keep their title.
+func ReadArchive(zr *zip.Reader, rootName string, audioExtensions []string) (*Archive, error) {
+	dirSet := map[string]bool{}
+	jsonFiles := map[string]*zip.File{}
+	archive := &Archive{}
+
+	addDir := func(dir string) {
+		for ; dir != "."; dir = path.Dir(dir) {
+			dirSet[dir] = true
+		}
+	}
+
+	for _, f := range zr.File {
+		name := path.Clean(strings.ReplaceAll(f.Name, `\`, "/"))
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("archive contains the invalid path %q", f.Name)
+		}
+
+		// Skip the metadata macOS and other systems add to archives
+		if strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+
+		if f.FileInfo().IsDir() {
+			addDir(name)
+			continue
+		}
+
+		dir := path.Dir(name)
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(path.Base(name), ext)
+
+		switch {
+		case strings.EqualFold(ext, "."+FormatJSON):
+			jsonFiles[path.Join(dir, base)] = f
+		case slices.Contains(audioExtensions, strings.ToLower(ext)):
+			addDir(dir)
+			archive.Audio = append(archive.Audio, ArchiveAudio{File: f, Dir: dir, Title: base})
+		}
+	}
+
+	for i, a := range archive.Audio {
+		if f, ok := jsonFiles[path.Join(a.Dir, a.Title)]; ok {
+			if title := exportedTitle(f); title != "" {
+				archive.Audio[i].Title = title
+			}
+		}
+	}
+
+	// Audio files need a folder to go in
+	topLevel := slices.ContainsFunc(archive.Audio, func(a ArchiveAudio) bool { return a.Dir == "." })
+
+	if topLevel {
+		archive.Dirs = append(archive.Dirs, rootName)
+		for i := range archive.Audio {
+			archive.Audio[i].Dir = path.Join(rootName, archive.Audio[i].Dir)
+		}
+	}
+	for dir := range dirSet {
+		if topLevel {
+			dir = path.Join(rootName, dir)
+		}
+		archive.Dirs = append(archive.Dirs, dir)
+	}
+
+	if len(archive.Dirs) == 0 {
+		return nil, errors.New("archive contains no folders or audio files")
+	}
+
+	sort.Strings(archive.Dirs)
+
+	return archive, nil
+}
+
+// exportedTitle returns the title from a note's JSON export, or "" if the
+// file isn't one
+func exportedTitle(f *zip.File) string {
+	rc, err := f.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+
+	var exported struct {
+		Title string `json:"title"`
+	}
+	if err := json.NewDecoder(io.LimitReader(rc, 10<<20)).Decode(&exported); err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(exported.Title)
+}
@@ -0,0 +1,232 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+// Export formats
+const (
+	FormatSRT      = "srt"
+	FormatVTT      = "vtt"
+	FormatMarkdown = "md"
+	FormatText     = "txt"
+	FormatJSON     = "json"
+)
+
+var Formats = []string{FormatSRT, FormatVTT, FormatMarkdown, FormatText, FormatJSON}
+
+// contentTypes maps each format to the media type it is served as
+var contentTypes = map[string]string{
+	FormatSRT:      "application/x-subrip; charset=utf-8",
+	FormatVTT:      "text/vtt; charset=utf-8",
+	FormatMarkdown: "text/markdown; charset=utf-8",
+	FormatText:     "text/plain; charset=utf-8",
+	FormatJSON:     "application/json",
+}
+
+// Document is a note together with what is rendered alongside it. Folder is
+// the name of the note's folder, empty for unfiled notes.
+type Document struct {
+	Note     *data.Note
+	Folder   string
+	Segments []*data.TranscriptSegment
+}
+
+// IsCaptions reports whether the format is a caption format, which can only
+// be rendered from timed segments
+func IsCaptions(format string) bool {
+	return format == FormatSRT || format == FormatVTT
+}
+
+// ContentType returns the media type of the format
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// ContentDisposition returns the Content-Disposition header that saves a
+// download as the given name and extension. Names that aren't plain ASCII are
+// encoded as RFC 2231 requires.
+func ContentDisposition(name, ext string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": Filename(name) + "." + ext})
+}
+
+// Render renders the document in the given format. Captions are cut from the
+// segments as transcribed, the other formats use the current transcript.
+func Render(format string, doc Document) ([]byte, error) {
+	switch format {
+	case FormatSRT:
+		return srt(doc.Segments), nil
+	case FormatVTT:
+		return vtt(doc.Segments), nil
+	case FormatMarkdown:
+		return markdown(doc), nil
+	case FormatText:
+		return []byte(strings.TrimSpace(doc.Note.Transcript.String) + "\n"), nil
+	case FormatJSON:
+		return jsonDocument(doc)
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// srt renders the segments as SubRip captions
+func srt(segments []*data.TranscriptSegment) []byte {
+	var b strings.Builder
+
+	for i, segment := range segments {
+		text := segment.Text
+		if segment.Speaker != "" {
+			text = segment.Speaker + ": " + text
+		}
+
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, timestamp(segment.Start, ","), timestamp(segment.End, ","), text)
+	}
+
+	return []byte(b.String())
+}
+
+// vtt renders the segments as WebVTT captions, with speakers as voice spans
+func vtt(segments []*data.TranscriptSegment) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+
+	escaper := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+	for i, segment := range segments {
+		text := escaper.Replace(segment.Text)
+		if segment.Speaker != "" {
+			text = fmt.Sprintf("<v %s>%s", escaper.Replace(segment.Speaker), text)
+		}
+
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, timestamp(segment.Start, "."), timestamp(segment.End, "."), text)
+	}
+
+	return []byte(b.String())
+}
+
+// markdown renders the note's metadata, summary and transcript. While the
+// segments still match the transcript, it is written one timestamped segment
+// per paragraph.
+func markdown(doc Document) []byte {
+	note := doc.Note
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", note.Title)
+
+	fmt.Fprintf(&b, "- **Created:** %s\n", note.CreatedAt.UTC().Format("2006-01-02 15:04 MST"))
+	fmt.Fprintf(&b, "- **Updated:** %s\n", note.UpdatedAt.UTC().Format("2006-01-02 15:04 MST"))
+	if doc.Folder != "" {
+		fmt.Fprintf(&b, "- **Folder:** %s\n", doc.Folder)
+	}
+	if note.Language != nil {
+		fmt.Fprintf(&b, "- **Language:** %s\n", *note.Language)
+	}
+	if len(doc.Segments) > 0 {
+		fmt.Fprintf(&b, "- **Duration:** %s\n", clock(doc.Segments[len(doc.Segments)-1].End))
+	}
+
+	if note.Summary.Valid {
+		fmt.Fprintf(&b, "\n## Summary\n\n%s\n", strings.TrimSpace(note.Summary.String))
+	}
+
+	b.WriteString("\n## Transcript\n\n")
+
+	if data.SegmentsMatchTranscript(note.Transcript.String, doc.Segments) {
+		for _, segment := range doc.Segments {
+			if segment.Speaker != "" {
+				fmt.Fprintf(&b, "**[%s] %s:** %s\n\n", clock(segment.Start), segment.Speaker, segment.Text)
+			} else {
+				fmt.Fprintf(&b, "**[%s]** %s\n\n", clock(segment.Start), segment.Text)
+			}
+		}
+	} else {
+		fmt.Fprintf(&b, "%s\n", strings.TrimSpace(note.Transcript.String))
+	}
+
+	return []byte(b.String())
+}
+
+// jsonNote is the JSON export of a note. The audio file path is left out as
+// it is only meaningful on the server.
+type jsonNote struct {
+	ID         int64                     `json:"id"`
+	Title      string                    `json:"title"`
+	Folder     string                    `json:"folder,omitempty"`
+	Language   *string                   `json:"language,omitempty"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	UpdatedAt  time.Time                 `json:"updated_at"`
+	Summary    string                    `json:"summary"`
+	Transcript string                    `json:"transcript"`
+	Segments   []*data.TranscriptSegment `json:"segments"`
+}
+
+// jsonDocument renders the note, its metadata and segments as JSON
+func jsonDocument(doc Document) ([]byte, error) {
+	segments := doc.Segments
+	if segments == nil {
+		segments = []*data.TranscriptSegment{}
+	}
+
+	js, err := json.MarshalIndent(jsonNote{
+		ID:         doc.Note.ID,
+		Title:      doc.Note.Title,
+		Folder:     doc.Folder,
+		Language:   doc.Note.Language,
+		CreatedAt:  doc.Note.CreatedAt,
+		UpdatedAt:  doc.Note.UpdatedAt,
+		Summary:    doc.Note.Summary.String,
+		Transcript: doc.Note.Transcript.String,
+		Segments:   segments,
+	}, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(js, '\n'), nil
+}
+
+// timestamp formats seconds as a caption timestamp, HH:MM:SS followed by the
+// separator and milliseconds
+func timestamp(seconds float64, separator string) string {
+	ms := int64(math.Round(math.Max(seconds, 0) * 1000))
+
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3_600_000, ms/60_000%60, ms/1000%60, separator, ms%1000)
+}
+
+// clock formats seconds as H:MM:SS, or M:SS under an hour
+func clock(seconds float64) string {
+	s := int64(math.Max(seconds, 0))
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// Filename turns a note or folder name into a safe file name without extension
+func Filename(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, title)
+
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "note"
+	}
+
+	return name
+}
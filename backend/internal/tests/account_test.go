@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestUserExports(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "exports-test@example.com",
+		Name:      "Exports Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	exportModel := pgContainer.Models.Exports
+
+	t.Run("Insert and mark ready", func(t *testing.T) {
+		userExport := &data.UserExport{UserID: user.Id}
+		if err := exportModel.Insert(userExport); err != nil {
+			t.Fatalf("Failed to insert export: %v", err)
+		}
+
+		if userExport.Status != data.ExportStatusPending {
+			t.Errorf("Expected a new export to be pending, got %q", userExport.Status)
+		}
+
+		err := exportModel.MarkReady(userExport, "/path/to/export.zip", time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to mark export ready: %v", err)
+		}
+
+		got, err := exportModel.Get(userExport.ID)
+		if err != nil {
+			t.Fatalf("Failed to get export: %v", err)
+		}
+
+		if got.Status != data.ExportStatusReady || got.FilePath != "/path/to/export.zip" || got.ExpiresAt == nil {
+			t.Errorf("Unexpected ready export: %+v", got)
+		}
+	})
+
+	t.Run("Mark failed", func(t *testing.T) {
+		userExport := &data.UserExport{UserID: user.Id}
+		if err := exportModel.Insert(userExport); err != nil {
+			t.Fatalf("Failed to insert export: %v", err)
+		}
+
+		err := exportModel.MarkFailed(userExport, errors.New("disk full"))
+		if err != nil {
+			t.Fatalf("Failed to mark export failed: %v", err)
+		}
+
+		if userExport.Status != data.ExportStatusFailed || userExport.Error == nil || *userExport.Error != "disk full" {
+			t.Errorf("Unexpected failed export: %+v", userExport)
+		}
+	})
+
+	t.Run("Purge expired", func(t *testing.T) {
+		userExport := &data.UserExport{UserID: user.Id}
+		if err := exportModel.Insert(userExport); err != nil {
+			t.Fatalf("Failed to insert export: %v", err)
+		}
+
+		err := exportModel.MarkReady(userExport, "/path/to/expired.zip", -time.Minute)
+		if err != nil {
+			t.Fatalf("Failed to mark export ready: %v", err)
+		}
+
+		paths, err := exportModel.PurgeExpired()
+		if err != nil {
+			t.Fatalf("Failed to purge exports: %v", err)
+		}
+
+		if len(paths) != 1 || paths[0] != "/path/to/expired.zip" {
+			t.Errorf("Expected only the expired archive to be purged, got %v", paths)
+		}
+
+		_, err = exportModel.Get(userExport.ID)
+		if !errors.Is(err, data.ErrRcordNotFound) {
+			t.Errorf("Expected the expired export to be deleted, got %v", err)
+		}
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "delete-test@example.com",
+		Name:      "Delete Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	folder := &data.Folder{
+		Name:   "Lectures",
+		UserID: user.Id,
+	}
+	if err := pgContainer.Models.Folders.Insert(folder); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Lecture 1",
+		AudioFilePath: "/path/to/lecture1.mp3",
+		UserID:        user.Id,
+		FolderID:      &folder.ID,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	trashed := &data.Note{
+		Title:         "Old lecture",
+		AudioFilePath: "/path/to/old.mp3",
+		UserID:        user.Id,
+	}
+	if err := pgContainer.Models.Notes.Insert(trashed); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+	if err := pgContainer.Models.Notes.SoftDelete(trashed); err != nil {
+		t.Fatalf("Failed to trash note: %v", err)
+	}
+
+	notes, err := pgContainer.Models.Notes.GetAllForUser(user.Id)
+	if err != nil {
+		t.Fatalf("Failed to get notes: %v", err)
+	}
+	if len(notes) != 2 {
+		t.Errorf("Expected the export listing to include trashed notes, got %d notes", len(notes))
+	}
+
+	token, err := pgContainer.Models.Tokens.New(user.Id, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	paths, err := pgContainer.Models.Users.Delete(user.Id)
+	if err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	if len(paths) != 2 {
+		t.Errorf("Expected the audio of both notes to be returned, got %v", paths)
+	}
+
+	if _, err := pgContainer.Models.Users.Retrieve(user.Id); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected the user to be deleted, got %v", err)
+	}
+
+	if _, err := pgContainer.Models.Folders.Get(folder.ID); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected the folder to be deleted, got %v", err)
+	}
+
+	if _, err := pgContainer.Models.Users.GetForToken(data.ScopeAuthentication, token.Plaintext); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected the user's tokens to be deleted, got %v", err)
+	}
+
+	if _, err := pgContainer.Models.Users.Delete(user.Id); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected deleting a missing user to fail with ErrRcordNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestChatSessions(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "chat-test@example.com",
+		Name:      "Chat Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	chatModel := pgContainer.Models.Chats
+
+	session := &data.ChatSession{UserID: user.Id, Title: "Standup questions"}
+	if err := chatModel.InsertSession(session); err != nil {
+		t.Fatalf("Failed to insert chat session: %v", err)
+	}
+
+	searchQuery := "what did Alice say about the release date"
+	messages := []*data.ChatMessage{
+		{SessionID: session.ID, Role: data.ChatRoleUser, Content: "what did Alice say?"},
+		{SessionID: session.ID, Role: data.ChatRoleAssistant, Content: "She is on leave [1].", Sources: json.RawMessage(`[{"index":1}]`)},
+		{SessionID: session.ID, Role: data.ChatRoleUser, Content: "and about the release?", SearchQuery: &searchQuery},
+	}
+
+	if err := chatModel.InsertMessages(messages...); err != nil {
+		t.Fatalf("Failed to insert chat messages: %v", err)
+	}
+
+	// A turn whose answer can't be stored leaves no question behind
+	failed := []*data.ChatMessage{
+		{SessionID: session.ID, Role: data.ChatRoleUser, Content: "and the budget?"},
+		{SessionID: session.ID, Role: data.ChatRoleAssistant, Content: "Unknown.", Sources: json.RawMessage(`not json`)},
+	}
+	if err := chatModel.InsertMessages(failed...); err == nil {
+		t.Fatal("Expected invalid sources to fail the insert")
+	}
+
+	history, err := chatModel.GetMessages(session.ID, 0)
+	if err != nil {
+		t.Fatalf("Failed to get chat messages: %v", err)
+	}
+
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(history))
+	}
+
+	if history[1].Sources == nil || history[0].Sources != nil {
+		t.Errorf("Expected sources only on the assistant message")
+	}
+
+	if history[2].SearchQuery == nil || *history[2].SearchQuery != searchQuery {
+		t.Errorf("Expected the reformulated search query to be stored")
+	}
+
+	// Fold the first two messages into the summary
+	session.Summary = "Alice is on leave."
+	session.SummarizedThrough = history[1].ID
+	if err := chatModel.UpdateSummary(session); err != nil {
+		t.Fatalf("Failed to update summary: %v", err)
+	}
+
+	history, err = chatModel.GetMessages(session.ID, session.SummarizedThrough)
+	if err != nil {
+		t.Fatalf("Failed to get chat messages: %v", err)
+	}
+
+	if len(history) != 1 {
+		t.Errorf("Expected 1 message outside the summary, got %d", len(history))
+	}
+
+	// A stale version is rejected
+	session.Version--
+	if err := chatModel.UpdateSummary(session); !errors.Is(err, data.ErrEditConflict) {
+		t.Errorf("Expected an edit conflict, got %v", err)
+	}
+
+	// A chat over a folder that is purged is orphaned, not widened to every note
+	folder := &data.Folder{Name: "Standups", UserID: user.Id}
+	if err := pgContainer.Models.Folders.Insert(folder); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	folderSession := &data.ChatSession{UserID: user.Id, FolderID: &folder.ID, Title: "Folder chat"}
+	if err := chatModel.InsertSession(folderSession); err != nil {
+		t.Fatalf("Failed to insert chat session: %v", err)
+	}
+
+	if err := pgContainer.Models.Folders.Delete(folder.ID); err != nil {
+		t.Fatalf("Failed to delete folder: %v", err)
+	}
+
+	got, err := chatModel.GetSession(folderSession.ID)
+	if err != nil {
+		t.Fatalf("Failed to get chat session: %v", err)
+	}
+
+	if got.FolderID != nil || !got.Orphaned {
+		t.Errorf("Expected the session to be orphaned, got %+v", got)
+	}
+
+	if got, err := chatModel.GetSession(session.ID); err != nil || got.Orphaned {
+		t.Errorf("Expected a chat over all notes not to be orphaned, got %+v, %v", got, err)
+	}
+}
@@ -122,6 +122,25 @@ func applyMigrations(t *testing.T, db *sql.DB) error {
 		"000004_create_folders_table.up.sql",
 		"000005_create_note_transcript_embeddings_table.up.sql",
 		"000006_create_social_auth_table.up.sql",
+		"000007_create_jobs_table.up.sql",
+		"000008_add_status_to_notes.up.sql",
+		"000009_create_note_revisions_table.up.sql",
+		"000010_add_deleted_at_to_notes_and_folders.up.sql",
+		"000011_add_search_vector_to_notes.up.sql",
+		"000012_add_search_vector_to_embeddings.up.sql",
+		"000013_add_user_id_to_embeddings.up.sql",
+		"000014_sync_embedding_folders.up.sql",
+		"000015_create_chat_tables.up.sql",
+		"000016_add_pipeline_to_users.up.sql",
+		"000017_create_transcript_segments.up.sql",
+		"000018_create_user_exports.up.sql",
+		"000019_add_language_to_notes.up.sql",
+		"000020_create_note_translations.up.sql",
+		"000021_create_prompt_templates.up.sql",
+		"000022_unique_pending_note_jobs.up.sql",
+		"000023_add_folder_scoped_to_chat_sessions.up.sql",
+		"000024_create_folder_imports.up.sql",
+		"000025_unique_pending_chat_summaries.up.sql",
 	}
 
 	for _, migration := range upMigrations {
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/m0hh/Notes/internal/events"
+)
+
+func TestHubPublish(t *testing.T) {
+	hub := events.New()
+
+	sub := hub.Subscribe(1)
+	other := hub.Subscribe(2)
+
+	// Publish an event for the first user only
+	hub.Publish(events.Event{Type: events.TypeStatus, NoteID: 10, UserID: 1})
+
+	select {
+	case event := <-sub.C:
+		if event.NoteID != 10 {
+			t.Errorf("Expected note ID 10, got %d", event.NoteID)
+		}
+	default:
+		t.Fatalf("Expected subscriber to receive the event")
+	}
+
+	select {
+	case event := <-other.C:
+		t.Errorf("Expected other user to receive nothing, got %+v", event)
+	default:
+	}
+
+	// Unsubscribing closes the channel
+	hub.Unsubscribe(sub)
+	if _, ok := <-sub.C; ok {
+		t.Errorf("Expected subscription channel to be closed")
+	}
+
+	// Publishing after unsubscribe must not panic
+	hub.Publish(events.Event{Type: events.TypeStatus, NoteID: 10, UserID: 1})
+
+	hub.Unsubscribe(other)
+}
@@ -0,0 +1,215 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/export"
+)
+
+func exportDocument() export.Document {
+	created := time.Date(2025, 3, 14, 9, 30, 0, 0, time.UTC)
+
+	return export.Document{
+		Note: &data.Note{
+			ID:         7,
+			Title:      "Standup",
+			Transcript: sql.NullString{String: "Morning all.\nShipping <today>.", Valid: true},
+			Summary:    sql.NullString{String: "The release ships today.", Valid: true},
+			CreatedAt:  created,
+			UpdatedAt:  created,
+		},
+		Folder: "Team",
+		Segments: []*data.TranscriptSegment{
+			{Start: 0, End: 1.25, Speaker: "Speaker 1", Text: "Morning all."},
+			{Start: 3661.5, End: 3663, Text: "Shipping <today>."},
+		},
+	}
+}
+
+func TestExportCaptions(t *testing.T) {
+	doc := exportDocument()
+
+	srt, err := export.Render(export.FormatSRT, doc)
+	if err != nil {
+		t.Fatalf("Failed to render SRT: %v", err)
+	}
+
+	expected := "1\n00:00:00,000 --> 00:00:01,250\nSpeaker 1: Morning all.\n\n2\n01:01:01,500 --> 01:01:03,000\nShipping <today>.\n\n"
+	if string(srt) != expected {
+		t.Errorf("Unexpected SRT:\n%s", srt)
+	}
+
+	vtt, err := export.Render(export.FormatVTT, doc)
+	if err != nil {
+		t.Fatalf("Failed to render WebVTT: %v", err)
+	}
+
+	// Speakers become voice spans and cue text is escaped
+	expected = "WEBVTT\n\n1\n00:00:00.000 --> 00:00:01.250\n<v Speaker 1>Morning all.\n\n2\n01:01:01.500 --> 01:01:03.000\nShipping &lt;today&gt;.\n\n"
+	if string(vtt) != expected {
+		t.Errorf("Unexpected WebVTT:\n%s", vtt)
+	}
+}
+
+func TestExportDocuments(t *testing.T) {
+	doc := exportDocument()
+
+	md, err := export.Render(export.FormatMarkdown, doc)
+	if err != nil {
+		t.Fatalf("Failed to render Markdown: %v", err)
+	}
+
+	for _, want := range []string{"# Standup", "- **Folder:** Team", "- **Duration:** 1:01:03", "## Summary\n\nThe release ships today.", "**[0:00] Speaker 1:** Morning all.", "**[1:01:01]** Shipping <today>."} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("Expected the Markdown to contain %q:\n%s", want, md)
+		}
+	}
+
+	// An edited transcript is exported as it is rather than from the segments
+	doc.Note.Transcript.String = "Morning everyone."
+	md, err = export.Render(export.FormatMarkdown, doc)
+	if err != nil {
+		t.Fatalf("Failed to render Markdown: %v", err)
+	}
+	if !strings.Contains(string(md), "## Transcript\n\nMorning everyone.\n") {
+		t.Errorf("Expected the edited transcript in the Markdown:\n%s", md)
+	}
+
+	txt, err := export.Render(export.FormatText, doc)
+	if err != nil {
+		t.Fatalf("Failed to render text: %v", err)
+	}
+	if string(txt) != "Morning everyone.\n" {
+		t.Errorf("Expected only the transcript in the text export, got %q", txt)
+	}
+
+	js, err := export.Render(export.FormatJSON, doc)
+	if err != nil {
+		t.Fatalf("Failed to render JSON: %v", err)
+	}
+
+	var exported map[string]any
+	if err := json.Unmarshal(js, &exported); err != nil {
+		t.Fatalf("Failed to decode JSON export: %v", err)
+	}
+	if exported["summary"] != "The release ships today." || exported["folder"] != "Team" || len(exported["segments"].([]any)) != 2 {
+		t.Errorf("Unexpected JSON export: %s", js)
+	}
+	if _, ok := exported["audio_file_path"]; ok {
+		t.Errorf("Expected the audio file path to be left out of the JSON export")
+	}
+}
+
+func TestExportContentDisposition(t *testing.T) {
+	tests := []struct {
+		title    string
+		format   string
+		expected string
+	}{
+		{"Standup", export.FormatSRT, `attachment; filename=Standup.srt`},
+		{"Q1 plan: draft/v2", export.FormatMarkdown, `attachment; filename="Q1 plan_ draft_v2.md"`},
+		{"اجتماع", export.FormatText, `attachment; filename*=utf-8''%D8%A7%D8%AC%D8%AA%D9%85%D8%A7%D8%B9.txt`},
+		{"...", export.FormatJSON, `attachment; filename=note.json`},
+	}
+
+	for _, tt := range tests {
+		if got := export.ContentDisposition(tt.title, tt.format); got != tt.expected {
+			t.Errorf("ContentDisposition(%q, %q) = %s, expected %s", tt.title, tt.format, got, tt.expected)
+		}
+	}
+}
+
+// zipReader builds an in-memory ZIP with the given entries; names ending in
+// a slash are directories
+func zipReader(t *testing.T, entries map[string]string) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			f.Write([]byte(content))
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to close ZIP: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read ZIP: %v", err)
+	}
+
+	return zr
+}
+
+func TestReadArchive(t *testing.T) {
+	audioExtensions := []string{".mp3", ".wav", ".m4a", ".ogg"}
+
+	// A folder archive as exported by the API
+	archive, err := export.ReadArchive(zipReader(t, map[string]string{
+		"Work/":                    "",
+		"Work/Standup.m4a":         "audio",
+		"Work/Standup.json":        `{"title": "Stand-up: Monday"}`,
+		"Work/Standup.md":          "# Stand-up: Monday",
+		"Work/Empty/":              "",
+		"Work/Projects/Plan.MP3":   "audio",
+		"__MACOSX/Work/._Plan.mp3": "",
+		"Work/.DS_Store":           "",
+	}), "Work", audioExtensions)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	if expected := []string{"Work", "Work/Empty", "Work/Projects"}; !reflect.DeepEqual(archive.Dirs, expected) {
+		t.Errorf("Expected folders %v, got %v", expected, archive.Dirs)
+	}
+
+	titles := map[string]string{}
+	for _, a := range archive.Audio {
+		titles[a.Title] = a.Dir
+	}
+	if expected := map[string]string{"Stand-up: Monday": "Work", "Plan": "Work/Projects"}; !reflect.DeepEqual(titles, expected) {
+		t.Errorf("Expected notes %v, got %v", expected, titles)
+	}
+
+	// A plain ZIP of audio files goes into a folder named after the archive
+	archive, err = export.ReadArchive(zipReader(t, map[string]string{
+		"week1.mp3":     "audio",
+		"extra/lab.wav": "audio",
+		"readme.txt":    "ignored",
+	}), "Lectures", audioExtensions)
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+
+	if expected := []string{"Lectures", "Lectures/extra"}; !reflect.DeepEqual(archive.Dirs, expected) {
+		t.Errorf("Expected folders %v, got %v", expected, archive.Dirs)
+	}
+	if len(archive.Audio) != 2 {
+		t.Errorf("Expected 2 audio files, got %d", len(archive.Audio))
+	}
+
+	// Paths escaping the archive are rejected
+	_, err = export.ReadArchive(zipReader(t, map[string]string{"../evil.mp3": "audio"}), "Evil", audioExtensions)
+	if err == nil {
+		t.Errorf("Expected a path outside the archive to be rejected")
+	}
+
+	_, err = export.ReadArchive(zipReader(t, map[string]string{"notes.txt": "text"}), "Empty", audioExtensions)
+	if err == nil {
+		t.Errorf("Expected an archive without folders or audio to be rejected")
+	}
+}
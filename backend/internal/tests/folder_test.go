@@ -144,7 +144,7 @@ func TestAddNoteToFolder(t *testing.T) {
 	}
 
 	folderIDPointer := &folder.ID
-	folderNotes, err := noteModel.GetByFolder(user.Id, folderIDPointer, filters)
+	folderNotes, err := noteModel.GetByFolder(user.Id, folderIDPointer, "", filters)
 	if err != nil {
 		t.Fatalf("Failed to get notes in folder: %v", err)
 	}
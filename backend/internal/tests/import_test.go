@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestFolderImports(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "imports-test@example.com",
+		Name:      "Imports Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	importModel := pgContainer.Models.Imports
+	process := data.ProcessNoteAudioPayload{SummaryLanguage: "fr"}
+
+	t.Run("Failure leaves nothing behind", func(t *testing.T) {
+		folderImport := &data.FolderImport{UserID: user.Id, Name: "broken", ArchivePath: "/path/to/broken.zip"}
+		if err := importModel.Insert(folderImport, data.ImportFolderPayload{}, 3); err != nil {
+			t.Fatalf("Failed to insert import: %v", err)
+		}
+
+		// The second note's folder isn't part of the import
+		folders := []data.ImportedFolder{{Path: "broken", Name: "broken"}}
+		notes := []data.ImportedNote{
+			{Dir: "broken", Title: "One", AudioFilePath: "/path/to/one.mp3"},
+			{Dir: "missing", Title: "Two", AudioFilePath: "/path/to/two.mp3"},
+		}
+		if err := importModel.Complete(folderImport, folders, notes, process, 3); err == nil {
+			t.Fatal("Expected a note without a folder to fail the import")
+		}
+
+		allFolders, err := pgContainer.Models.Folders.GetAllForUser(user.Id)
+		if err != nil {
+			t.Fatalf("Failed to list folders: %v", err)
+		}
+		allNotes, err := pgContainer.Models.Notes.GetAllForUser(user.Id)
+		if err != nil {
+			t.Fatalf("Failed to list notes: %v", err)
+		}
+		if len(allFolders) != 0 || len(allNotes) != 0 {
+			t.Errorf("Expected no folders or notes, got %d and %d", len(allFolders), len(allNotes))
+		}
+
+		if err := importModel.MarkFailed(folderImport, errors.New("no folder")); err != nil {
+			t.Fatalf("Failed to mark import failed: %v", err)
+		}
+		if folderImport.Status != data.ImportStatusFailed || folderImport.Error == nil {
+			t.Errorf("Unexpected failed import: %+v", folderImport)
+		}
+	})
+
+	t.Run("Complete", func(t *testing.T) {
+		folderImport := &data.FolderImport{UserID: user.Id, Name: "lectures", ArchivePath: "/path/to/lectures.zip"}
+		if err := importModel.Insert(folderImport, data.ImportFolderPayload{}, 3); err != nil {
+			t.Fatalf("Failed to insert import: %v", err)
+		}
+
+		if folderImport.Status != data.ImportStatusPending {
+			t.Errorf("Expected a new import to be pending, got %q", folderImport.Status)
+		}
+
+		folders := []data.ImportedFolder{
+			{Path: "lectures", Name: "lectures"},
+			{Path: "lectures/week 1", Name: "week 1"},
+		}
+		notes := []data.ImportedNote{
+			{Dir: "lectures", Title: "Intro", AudioFilePath: "/path/to/intro.mp3"},
+			{Dir: "lectures/week 1", Title: "Monday", AudioFilePath: "/path/to/monday.mp3"},
+		}
+		if err := importModel.Complete(folderImport, folders, notes, process, 3); err != nil {
+			t.Fatalf("Failed to complete import: %v", err)
+		}
+
+		got, err := importModel.Get(folderImport.ID)
+		if err != nil {
+			t.Fatalf("Failed to get import: %v", err)
+		}
+		if got.Status != data.ImportStatusReady || got.FolderCount != 2 || got.NoteCount != 2 {
+			t.Errorf("Unexpected completed import: %+v", got)
+		}
+
+		roots, err := pgContainer.Models.Folders.GetRootFolders(user.Id)
+		if err != nil {
+			t.Fatalf("Failed to list folders: %v", err)
+		}
+		if len(roots) != 1 || roots[0].Name != "lectures" {
+			t.Fatalf("Expected one top-level folder, got %+v", roots)
+		}
+
+		children, err := pgContainer.Models.Folders.GetChildren(roots[0].ID, user.Id)
+		if err != nil {
+			t.Fatalf("Failed to list subfolders: %v", err)
+		}
+		if len(children) != 1 || children[0].Name != "week 1" {
+			t.Errorf("Expected the week to be inside the lectures, got %+v", children)
+		}
+
+		allNotes, err := pgContainer.Models.Notes.GetAllForUser(user.Id)
+		if err != nil {
+			t.Fatalf("Failed to list notes: %v", err)
+		}
+		if len(allNotes) != 2 {
+			t.Fatalf("Expected two notes, got %d", len(allNotes))
+		}
+		for _, note := range allNotes {
+			pending, err := pgContainer.Models.Jobs.HasPendingForNote(note.ID)
+			if err != nil {
+				t.Fatalf("Failed to check jobs: %v", err)
+			}
+			if !pending {
+				t.Errorf("Expected note %q to be queued for processing", note.Title)
+			}
+		}
+
+		// A second run of the job doesn't import the archive again
+		if err := importModel.Complete(folderImport, folders, notes, process, 3); !errors.Is(err, data.ErrEditConflict) {
+			t.Errorf("Expected ErrEditConflict, got %v", err)
+		}
+	})
+
+	t.Run("Purged parent", func(t *testing.T) {
+		parent := &data.Folder{Name: "Archive", UserID: user.Id}
+		if err := pgContainer.Models.Folders.Insert(parent); err != nil {
+			t.Fatalf("Failed to insert folder: %v", err)
+		}
+
+		folderImport := &data.FolderImport{UserID: user.Id, ParentID: &parent.ID, Name: "old", ArchivePath: "/path/to/old.zip"}
+		if err := importModel.Insert(folderImport, data.ImportFolderPayload{}, 3); err != nil {
+			t.Fatalf("Failed to insert import: %v", err)
+		}
+
+		if err := pgContainer.Models.Folders.Delete(parent.ID); err != nil {
+			t.Fatalf("Failed to delete folder: %v", err)
+		}
+
+		// The import stays, with its archive path, and still knows it had a
+		// folder to go into
+		got, err := importModel.Get(folderImport.ID)
+		if err != nil {
+			t.Fatalf("Expected the import to outlive its folder, got %v", err)
+		}
+		if got.ParentID != nil || !got.HasParent || got.ArchivePath != folderImport.ArchivePath {
+			t.Errorf("Unexpected import after its folder was purged: %+v", got)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestClaimJob(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	jobModel := pgContainer.Models.Jobs
+
+	// Enqueue a job
+	job, err := jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 1, Prompt: "test"}, 3)
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	if job.Status != data.JobStatusQueued {
+		t.Errorf("Expected status %s, got %s", data.JobStatusQueued, job.Status)
+	}
+
+	// Claim the job
+	claimed, err := jobModel.Claim("worker-1")
+	if err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+
+	if claimed.ID != job.ID {
+		t.Errorf("Expected job ID %d, got %d", job.ID, claimed.ID)
+	}
+
+	if claimed.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", claimed.Attempts)
+	}
+
+	// A second worker must not get the same job
+	_, err = jobModel.Claim("worker-2")
+	if !errors.Is(err, data.ErrNoJobs) {
+		t.Errorf("Expected ErrNoJobs, got %v", err)
+	}
+
+	// Complete the job
+	err = jobModel.Complete(claimed)
+	if err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+
+	if claimed.Status != data.JobStatusCompleted {
+		t.Errorf("Expected status %s, got %s", data.JobStatusCompleted, claimed.Status)
+	}
+}
+
+func TestFailJobMovesToDeadLetter(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	jobModel := pgContainer.Models.Jobs
+
+	_, err = jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 1}, 2)
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	// First failure requeues the job immediately
+	job, err := jobModel.Claim("worker-1")
+	if err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+
+	err = jobModel.Fail(job, errors.New("gemini unavailable"), 0)
+	if err != nil {
+		t.Fatalf("Failed to fail job: %v", err)
+	}
+
+	if job.Status != data.JobStatusQueued {
+		t.Errorf("Expected status %s, got %s", data.JobStatusQueued, job.Status)
+	}
+
+	// Second failure uses the last attempt
+	job, err = jobModel.Claim("worker-1")
+	if err != nil {
+		t.Fatalf("Failed to claim job again: %v", err)
+	}
+
+	err = jobModel.Fail(job, errors.New("gemini unavailable"), time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to fail job: %v", err)
+	}
+
+	if job.Status != data.JobStatusDead {
+		t.Errorf("Expected status %s, got %s", data.JobStatusDead, job.Status)
+	}
+
+	if job.LastError.String != "gemini unavailable" {
+		t.Errorf("Expected last error to be recorded, got %q", job.LastError.String)
+	}
+
+	// Dead jobs are never claimed
+	_, err = jobModel.Claim("worker-1")
+	if !errors.Is(err, data.ErrNoJobs) {
+		t.Errorf("Expected ErrNoJobs, got %v", err)
+	}
+}
+
+func TestRequeueStaleJobs(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	jobModel := pgContainer.Models.Jobs
+
+	// One job has attempts left, the other has used its last one
+	for _, maxAttempts := range []int{3, 1} {
+		_, err = jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 1}, maxAttempts)
+		if err != nil {
+			t.Fatalf("Failed to enqueue job: %v", err)
+		}
+
+		if _, err := jobModel.Claim("worker-1"); err != nil {
+			t.Fatalf("Failed to claim job: %v", err)
+		}
+	}
+
+	// A negative lease makes every running job stale
+	requeued, dead, err := jobModel.RequeueStale(-time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to requeue stale jobs: %v", err)
+	}
+
+	if requeued != 1 {
+		t.Errorf("Expected one job to be requeued, got %d", requeued)
+	}
+
+	if len(dead) != 1 || dead[0].MaxAttempts != 1 || dead[0].Status != data.JobStatusDead {
+		t.Fatalf("Expected the job without attempts left to be returned as dead, got %+v", dead)
+	}
+
+	if dead[0].LastError.String != "worker lease expired" {
+		t.Errorf("Expected the lease error to be recorded, got %q", dead[0].LastError.String)
+	}
+}
+
+func TestEnqueueDuplicateNoteJob(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	jobModel := pgContainer.Models.Jobs
+
+	_, err = jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 1}, 3)
+	if err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+
+	pending, err := jobModel.HasPendingForNote(1)
+	if err != nil || !pending {
+		t.Errorf("Expected the note to have a pending job, got %v, %v", pending, err)
+	}
+
+	// A second run of the same note is refused, other notes aren't affected
+	_, err = jobModel.Enqueue(data.JobKindRegenerateSummary, data.RegenerateSummaryPayload{NoteID: 1}, 3)
+	if !errors.Is(err, data.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob, got %v", err)
+	}
+
+	_, err = jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 2}, 3)
+	if err != nil {
+		t.Fatalf("Failed to enqueue job for another note: %v", err)
+	}
+
+	// A chat is summarized by one job at a time too
+	_, err = jobModel.Enqueue(data.JobKindSummarizeChat, data.SummarizeChatPayload{SessionID: 1}, 3)
+	if err != nil {
+		t.Fatalf("Failed to enqueue chat summary: %v", err)
+	}
+
+	_, err = jobModel.Enqueue(data.JobKindSummarizeChat, data.SummarizeChatPayload{SessionID: 1}, 3)
+	if !errors.Is(err, data.ErrDuplicateJob) {
+		t.Errorf("Expected ErrDuplicateJob for a second chat summary, got %v", err)
+	}
+
+	// Once the job is done the note can be processed again
+	job, err := jobModel.Claim("worker-1")
+	if err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if err := jobModel.Complete(job); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+
+	_, err = jobModel.Enqueue(data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: 1}, 3)
+	if err != nil {
+		t.Errorf("Expected a finished note to be processed again, got %v", err)
+	}
+}
+
+func TestEnqueueNoteRun(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "rerun-test@example.com",
+		Name:      "Rerun Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Rerun Note",
+		AudioFilePath: "/test/rerun.mp3",
+		UserID:        user.Id,
+	}
+
+	err = pgContainer.Models.Notes.Insert(note)
+	if err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	err = pgContainer.Models.Notes.UpdateStatus(note, data.NoteStatusReady, nil)
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	jobModel := pgContainer.Models.Jobs
+
+	_, err = jobModel.EnqueueNoteRun(note, data.JobKindRegenerateSummary, data.RegenerateSummaryPayload{NoteID: note.ID}, 3)
+	if err != nil {
+		t.Fatalf("Failed to enqueue run: %v", err)
+	}
+	if note.Status != data.NoteStatusUploaded {
+		t.Errorf("Expected the note to be back to uploaded, got %s", note.Status)
+	}
+
+	// A worker's progress isn't undone by a run that is refused
+	err = pgContainer.Models.Notes.UpdateStatus(note, data.NoteStatusSummarizing, nil)
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	_, err = jobModel.EnqueueNoteRun(note, data.JobKindProcessNoteAudio, data.ProcessNoteAudioPayload{NoteID: note.ID}, 3)
+	if !errors.Is(err, data.ErrDuplicateJob) {
+		t.Fatalf("Expected ErrDuplicateJob, got %v", err)
+	}
+
+	got, err := pgContainer.Models.Notes.Get(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if got.Status != data.NoteStatusSummarizing {
+		t.Errorf("Expected the note to still be summarizing, got %s", got.Status)
+	}
+}
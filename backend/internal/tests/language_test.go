@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/m0hh/Notes/internal/ai"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"en", "en"},
+		{"EN", "en"},
+		{"pt-br", "pt-BR"},
+		{"pt_BR", "pt-BR"},
+		{"zh-hant-tw", "zh-Hant-TW"},
+		{"es-419", "es-419"},
+		// Older clients and Whisper name languages in English
+		{"english", "en"},
+		{"Arabic", "ar"},
+	}
+
+	for _, tt := range tests {
+		got, err := ai.ParseLanguage(tt.input)
+		if err != nil {
+			t.Errorf("ParseLanguage(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLanguage(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "klingon", "xx", "en-", "en-toolongtag", "en-US-Latn"} {
+		if _, err := ai.ParseLanguage(input); err == nil {
+			t.Errorf("Expected ParseLanguage(%q) to fail", input)
+		}
+	}
+}
+
+func TestPipelineLanguages(t *testing.T) {
+	registry, err := ai.NewRegistry(ai.Config{
+		Transcription: []string{"gemini"},
+		Chat:          []string{"openai"},
+		Embedding:     "openai",
+		Pipelines: map[string]ai.PipelineConfig{
+			"fallback": {Transcription: []string{"gemini", "whisper"}, Summarization: []string{"deepseek"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	pipeline, err := registry.Pipeline("")
+	if err != nil {
+		t.Fatalf("Failed to get default pipeline: %v", err)
+	}
+
+	// Gemini transcribes Bengali; Whisper doesn't
+	if !ai.LanguageSupported(pipeline.TranscriptLanguages(), "bn-IN") {
+		t.Errorf("Expected the gemini pipeline to transcribe Bengali")
+	}
+
+	fallback, err := registry.Pipeline("fallback")
+	if err != nil {
+		t.Fatalf("Failed to get fallback pipeline: %v", err)
+	}
+
+	// A chain only offers what every provider in it supports
+	if ai.LanguageSupported(fallback.TranscriptLanguages(), "bn") {
+		t.Errorf("Expected a chain falling back to whisper not to offer Bengali")
+	}
+	if !ai.LanguageSupported(fallback.TranscriptLanguages(), "pt-BR") {
+		t.Errorf("Expected the fallback pipeline to transcribe Portuguese")
+	}
+
+	// DeepSeek declares no languages, so the summary follows the transcriber
+	if !ai.LanguageSupported(fallback.SummaryLanguages(), "ja") || ai.LanguageSupported(fallback.SummaryLanguages(), "bn") {
+		t.Errorf("Unexpected summary languages: %v", fallback.SummaryLanguages())
+	}
+
+	languages := ai.Languages(pipeline.TranscriptLanguages())
+	if len(languages) == 0 || languages[0].Name == "" {
+		t.Errorf("Expected named languages, got %v", languages)
+	}
+}
@@ -2,6 +2,8 @@ package tests
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"testing"
 
 	"github.com/m0hh/Notes/internal/data"
@@ -143,7 +145,7 @@ func TestGetAllUserNotes(t *testing.T) {
 	}
 
 	// Retrieve notes with pagination
-	retrievedNotes, err := noteModel.GetAll(user.Id, filters)
+	retrievedNotes, err := noteModel.GetAll(user.Id, "", filters)
 	if err != nil {
 		t.Fatalf("Failed to get all notes: %v", err)
 	}
@@ -154,7 +156,7 @@ func TestGetAllUserNotes(t *testing.T) {
 
 	// Get the second page (should have 1 note)
 	filters.Page = 2
-	retrievedNotes, err = noteModel.GetAll(user.Id, filters)
+	retrievedNotes, err = noteModel.GetAll(user.Id, "", filters)
 	if err != nil {
 		t.Fatalf("Failed to get second page of notes: %v", err)
 	}
@@ -163,3 +165,199 @@ func TestGetAllUserNotes(t *testing.T) {
 		t.Errorf("Expected 1 note on second page, got %d", len(retrievedNotes))
 	}
 }
+
+func TestNoteStatus(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	// Create a test user
+	userModel := pgContainer.Models.Users
+	user := &data.User{
+		Email:     "note-status-test@example.com",
+		Name:      "Note Status",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = userModel.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	noteModel := pgContainer.Models.Notes
+
+	note := &data.Note{
+		Title:         "Status Note",
+		AudioFilePath: "/test/status.mp3",
+		UserID:        user.Id,
+	}
+
+	err = noteModel.Insert(note)
+	if err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	// New notes start as uploaded
+	if note.Status != data.NoteStatusUploaded {
+		t.Errorf("Expected status %s, got %s", data.NoteStatusUploaded, note.Status)
+	}
+
+	// Move the note to transcribing and then to failed
+	err = noteModel.UpdateStatus(note, data.NoteStatusTranscribing, nil)
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	if note.TranscribingAt == nil {
+		t.Errorf("Expected transcribing_at to be set")
+	}
+
+	// A failed attempt that will be retried keeps its error
+	err = noteModel.UpdateStatus(note, data.NoteStatusRetrying, errors.New("gemini timeout"))
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	if note.Status != data.NoteStatusRetrying || note.StatusError == nil || *note.StatusError != "gemini timeout" {
+		t.Errorf("Expected the note to be retrying with its error, got %s", note.Status)
+	}
+
+	err = noteModel.UpdateStatus(note, data.NoteStatusFailed, errors.New("gemini unavailable"))
+	if err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	if note.StatusError == nil || *note.StatusError != "gemini unavailable" {
+		t.Errorf("Expected status error to be recorded")
+	}
+
+	// The status filter only returns failed notes
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     10,
+		Sort:         "id",
+		SortSafelist: []string{"id"},
+	}
+
+	failedNotes, err := noteModel.GetAll(user.Id, data.NoteStatusFailed, filters)
+	if err != nil {
+		t.Fatalf("Failed to get failed notes: %v", err)
+	}
+
+	if len(failedNotes) != 1 {
+		t.Errorf("Expected 1 failed note, got %d", len(failedNotes))
+	}
+
+	readyNotes, err := noteModel.GetAll(user.Id, data.NoteStatusReady, filters)
+	if err != nil {
+		t.Fatalf("Failed to get ready notes: %v", err)
+	}
+
+	if len(readyNotes) != 0 {
+		t.Errorf("Expected 0 ready notes, got %d", len(readyNotes))
+	}
+}
+
+func TestProcessingSurvivesNonContentChanges(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "note-processing-test@example.com",
+		Name:      "Note Processing",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	folder := &data.Folder{Name: "Moved here", UserID: user.Id}
+	if err := pgContainer.Models.Folders.Insert(folder); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	noteModel := pgContainer.Models.Notes
+
+	note := &data.Note{
+		Title:         "Processing Note",
+		AudioFilePath: "/test/processing.mp3",
+		UserID:        user.Id,
+	}
+	if err := noteModel.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	// The pipeline works on the note as it read it
+	processing := *note
+
+	// The user moves the note while it is transcribed
+	note.FolderID = &folder.ID
+	if err := noteModel.UpdateFolder(note); err != nil {
+		t.Fatalf("Failed to move note: %v", err)
+	}
+
+	previous := processing.Content()
+	processing.Transcript = sql.NullString{String: "hello", Valid: true}
+	if err := noteModel.UpdateTranscript(&processing, previous); err != nil {
+		t.Fatalf("Expected the move not to stop the transcript, got %v", err)
+	}
+
+	previous = processing.Content()
+	processing.Summary = sql.NullString{String: "a greeting", Valid: true}
+	if err := noteModel.UpdateSummary(&processing, previous); err != nil {
+		t.Fatalf("Expected the move not to stop the summary, got %v", err)
+	}
+
+	got, err := noteModel.Get(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get note: %v", err)
+	}
+	if got.Summary.String != "a greeting" || got.FolderID == nil || *got.FolderID != folder.ID {
+		t.Errorf("Expected the processed note in its new folder, got %+v", got)
+	}
+
+	// Editing the content does stop a run that read the old content
+	previous = got.Content()
+	got.Summary = sql.NullString{String: "my own summary", Valid: true}
+	if err := noteModel.Update(got); err != nil {
+		t.Fatalf("Failed to edit note: %v", err)
+	}
+
+	processing.Summary = sql.NullString{String: "a new greeting", Valid: true}
+	if err := noteModel.UpdateSummary(&processing, previous); !errors.Is(err, data.ErrEditConflict) {
+		t.Errorf("Expected ErrEditConflict after the user's edit, got %v", err)
+	}
+}
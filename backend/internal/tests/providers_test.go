@@ -0,0 +1,491 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/ai"
+)
+
+// fakeChatModel answers with a fixed text, streamed in the given pieces, or
+// fails with err
+type fakeChatModel struct {
+	name   string
+	pieces []string
+	err    error
+}
+
+func (m fakeChatModel) Name() string {
+	return m.name
+}
+
+func (m fakeChatModel) Complete(ctx context.Context, prompt string) (string, error) {
+	return strings.Join(m.pieces, ""), m.err
+}
+
+func (m fakeChatModel) Stream(ctx context.Context, prompt string, onToken ai.TokenHandler) (string, error) {
+	var answer string
+	for _, piece := range m.pieces {
+		answer += piece
+		if err := onToken(piece); err != nil {
+			return answer, err
+		}
+	}
+	return answer, m.err
+}
+
+func TestChatModelChain(t *testing.T) {
+	down := fakeChatModel{name: "down", err: errors.New("unavailable")}
+	up := fakeChatModel{name: "up", pieces: []string{"hello", " world"}}
+
+	chain := ai.ChatModelChain{down, up}
+
+	if chain.Name() != "down,up" {
+		t.Errorf("Expected chain name %q, got %q", "down,up", chain.Name())
+	}
+
+	// The failing provider is skipped
+	answer, err := chain.Complete(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("Expected the second provider to answer: %v", err)
+	}
+	if answer != "hello world" {
+		t.Errorf("Expected %q, got %q", "hello world", answer)
+	}
+
+	var tokens []string
+	answer, err = chain.Stream(context.Background(), "hi", func(text string) error {
+		tokens = append(tokens, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected the second provider to stream: %v", err)
+	}
+	if answer != "hello world" || len(tokens) != 2 {
+		t.Errorf("Expected two tokens making %q, got %v", "hello world", tokens)
+	}
+
+	// A provider that fails mid-stream isn't followed by another answer
+	broken := fakeChatModel{name: "broken", pieces: []string{"hel"}, err: errors.New("connection reset")}
+	chain = ai.ChatModelChain{broken, up}
+
+	tokens = nil
+	_, err = chain.Stream(context.Background(), "hi", func(text string) error {
+		tokens = append(tokens, text)
+		return nil
+	})
+	if err == nil {
+		t.Fatalf("Expected the mid-stream failure to be returned")
+	}
+	if len(tokens) != 1 {
+		t.Errorf("Expected only the broken provider's token, got %v", tokens)
+	}
+
+	// Every failure is reported when no provider succeeds
+	chain = ai.ChatModelChain{down, fakeChatModel{name: "also-down", err: errors.New("quota exceeded")}}
+
+	_, err = chain.Complete(context.Background(), "hi")
+	if err == nil {
+		t.Fatalf("Expected an error when every provider fails")
+	}
+	if err.Error() != "down: unavailable\nalso-down: quota exceeded" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+// fakeTranscriber returns a fixed transcript, or fails with err
+type fakeTranscriber struct {
+	name string
+	err  error
+}
+
+func (f fakeTranscriber) Name() string {
+	return f.name
+}
+
+func (f fakeTranscriber) Transcribe(ctx context.Context, req ai.TranscriptionRequest) (*ai.Transcription, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ai.Transcription{Transcript: "hello"}, nil
+}
+
+func TestTranscriberChain(t *testing.T) {
+	chain := ai.TranscriberChain{
+		fakeTranscriber{name: "down", err: errors.New("unavailable")},
+		fakeTranscriber{name: "up"},
+	}
+
+	// The result names the provider that transcribed it, not the whole chain
+	result, err := chain.Transcribe(context.Background(), ai.TranscriptionRequest{})
+	if err != nil {
+		t.Fatalf("Expected the second provider to transcribe: %v", err)
+	}
+	if result.Provider != "up" {
+		t.Errorf("Expected provider %q, got %q", "up", result.Provider)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	registry, err := ai.NewRegistry(ai.Config{
+		Transcription: []string{"gemini"},
+		Chat:          []string{"gemini", "openai"},
+		Embedding:     "openai",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	if registry.Chat.Name() != "gemini,openai" {
+		t.Errorf("Expected the gemini,openai chat chain, got %q", registry.Chat.Name())
+	}
+
+	// Providers without an API key fail when used rather than at startup
+	_, err = registry.Embedder.Embed(context.Background(), "text")
+	if err == nil {
+		t.Errorf("Expected the embedder to fail without an API key")
+	}
+
+	_, err = ai.NewRegistry(ai.Config{
+		Transcription: []string{"gemini"},
+		Chat:          []string{"nope"},
+		Embedding:     "openai",
+	})
+	if err == nil {
+		t.Errorf("Expected an unknown chat provider to be rejected")
+	}
+}
+
+func TestRegistryPipelines(t *testing.T) {
+	registry, err := ai.NewRegistry(ai.Config{
+		Transcription: []string{"gemini"},
+		Chat:          []string{"gemini"},
+		Embedding:     "openai",
+		Pipelines: map[string]ai.PipelineConfig{
+			"whisper": {Transcription: []string{"whisper"}, Summarization: []string{"deepseek", "openai"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+
+	names := registry.PipelineNames()
+	if len(names) != 2 || names[0] != ai.DefaultPipeline || names[1] != "whisper" {
+		t.Errorf("Expected the default and whisper pipelines, got %v", names)
+	}
+
+	// An empty name selects the default pipeline
+	pipeline, err := registry.Pipeline("")
+	if err != nil {
+		t.Fatalf("Failed to get default pipeline: %v", err)
+	}
+	if pipeline.Transcriber.Name() != "gemini" {
+		t.Errorf("Expected the default pipeline to transcribe with gemini, got %q", pipeline.Transcriber.Name())
+	}
+
+	pipeline, err = registry.Pipeline("whisper")
+	if err != nil {
+		t.Fatalf("Failed to get whisper pipeline: %v", err)
+	}
+	if pipeline.Transcriber.Name() != "whisper" || pipeline.Summarizer.Name() != "deepseek,openai" {
+		t.Errorf("Unexpected whisper pipeline: %s then %s", pipeline.Transcriber.Name(), pipeline.Summarizer.Name())
+	}
+
+	if _, err := registry.Pipeline("missing"); err == nil {
+		t.Errorf("Expected an unknown pipeline to be rejected")
+	}
+
+	// Pipelines naming unknown providers are rejected at startup
+	_, err = ai.NewRegistry(ai.Config{
+		Transcription: []string{"gemini"},
+		Chat:          []string{"gemini"},
+		Embedding:     "openai",
+		Pipelines: map[string]ai.PipelineConfig{
+			"broken": {Transcription: []string{"whisper"}, Summarization: []string{"nope"}},
+		},
+	})
+	if err == nil {
+		t.Errorf("Expected a pipeline with an unknown provider to be rejected")
+	}
+}
+
+func TestOllamaService(t *testing.T) {
+	// A fake Ollama server that answers chats in two streamed pieces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/chat":
+			var req ai.OllamaChatRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Model != "llama3.1" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if !req.Stream {
+				json.NewEncoder(w).Encode(ai.OllamaChatResponse{Message: ai.Message{Role: "assistant", Content: "a local answer"}, Done: true})
+				return
+			}
+			for _, piece := range []string{"a local", " answer"} {
+				json.NewEncoder(w).Encode(ai.OllamaChatResponse{Message: ai.Message{Role: "assistant", Content: piece}})
+			}
+			json.NewEncoder(w).Encode(ai.OllamaChatResponse{Done: true})
+		case "/api/embeddings":
+			json.NewEncoder(w).Encode(ai.OllamaEmbeddingResponse{Embedding: unitVector(2).Slice()})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ollama := ai.NewOllamaService(server.URL+"/", "llama3.1", "local-embed")
+
+	answer, err := ollama.Complete(context.Background(), "hi")
+	if err != nil {
+		t.Fatalf("Failed to complete: %v", err)
+	}
+	if answer != "a local answer" {
+		t.Errorf("Expected %q, got %q", "a local answer", answer)
+	}
+
+	var tokens []string
+	answer, err = ollama.Stream(context.Background(), "hi", func(text string) error {
+		tokens = append(tokens, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to stream: %v", err)
+	}
+	if answer != "a local answer" || len(tokens) != 2 {
+		t.Errorf("Expected two tokens making %q, got %v", "a local answer", tokens)
+	}
+
+	embedding, err := ollama.Embed(context.Background(), "text")
+	if err != nil {
+		t.Fatalf("Failed to embed: %v", err)
+	}
+	if len(embedding) != 1536 || embedding[2] != 1 {
+		t.Errorf("Unexpected embedding returned")
+	}
+}
+
+func TestWhisperCppService(t *testing.T) {
+	// A fake whisper.cpp server that checks the uploaded audio
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" {
+			http.NotFound(w, r)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		audio, _ := io.ReadAll(file)
+		// Without a transcript language the server is asked to detect it
+		if string(audio) != "fake audio" || r.FormValue("response_format") != "verbose_json" || r.FormValue("language") != "auto" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		fmt.Fprint(w, `{"text": " transcribed locally \n", "segments": [{"start": 0, "end": 1.5, "text": " transcribed locally"}]}`)
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "memo.wav")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	whisper := ai.NewWhisperCppService(server.URL)
+
+	result, err := whisper.Transcribe(context.Background(), ai.TranscriptionRequest{AudioFilePath: audioPath})
+	if err != nil {
+		t.Fatalf("Failed to transcribe: %v", err)
+	}
+
+	if result.Transcript != "transcribed locally" {
+		t.Errorf("Expected %q, got %q", "transcribed locally", result.Transcript)
+	}
+
+	if len(result.Segments) != 1 || result.Segments[0].End != 1.5 || result.Segments[0].Text != "transcribed locally" {
+		t.Errorf("Unexpected segments: %+v", result.Segments)
+	}
+
+	// whisper.cpp only transcribes; the summary is left to a chat model
+	if result.Summary != "" {
+		t.Errorf("Expected no summary from whisper.cpp, got %q", result.Summary)
+	}
+}
+
+func TestWhisperService(t *testing.T) {
+	// A fake OpenAI-compatible transcription endpoint returning verbose_json
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" || r.Header.Get("Authorization") != "Bearer whisper-key" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("response_format") != "verbose_json" || r.FormValue("model") != "whisper-1" {
+			http.Error(w, "unexpected form", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{
+			"task": "transcribe",
+			"language": "english",
+			"duration": 6.5,
+			"text": " Hello there. General Kenobi.",
+			"segments": [
+				{"id": 0, "start": 0.0, "end": 2.4, "text": " Hello there."},
+				{"id": 1, "start": 2.4, "end": 6.5, "text": " General Kenobi."}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "memo.mp3")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	whisper := ai.NewWhisperService("whisper-key", server.URL+"/v1")
+
+	result, err := whisper.Transcribe(context.Background(), ai.TranscriptionRequest{AudioFilePath: audioPath})
+	if err != nil {
+		t.Fatalf("Failed to transcribe: %v", err)
+	}
+
+	if result.Transcript != "Hello there. General Kenobi." || result.Language != "english" {
+		t.Errorf("Unexpected transcription: %+v", result)
+	}
+
+	if len(result.Segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(result.Segments))
+	}
+
+	if result.Segments[1].Start != 2.4 || result.Segments[1].End != 6.5 || result.Segments[1].Text != "General Kenobi." {
+		t.Errorf("Unexpected segment: %+v", result.Segments[1])
+	}
+}
+
+func TestDeepSeekService(t *testing.T) {
+	// A fake OpenAI-compatible chat completion endpoint
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ai.OpenAICompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/chat/completions" || req.Model != "deepseek-chat" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "a short summary"}}]}`))
+	}))
+	defer server.Close()
+
+	deepseek := ai.NewDeepSeekService("deepseek-key", server.URL)
+
+	summary, err := ai.Summarize(context.Background(), deepseek, "a long transcript", "", "english")
+	if err != nil {
+		t.Fatalf("Failed to summarize: %v", err)
+	}
+
+	if summary != "a short summary" {
+		t.Errorf("Expected %q, got %q", "a short summary", summary)
+	}
+
+	// Without a key the provider fails before sending anything
+	_, err = ai.NewDeepSeekService("", server.URL).Complete(context.Background(), "hi")
+	if err == nil {
+		t.Errorf("Expected an error without an API key")
+	}
+
+	// A failed request reports what the API said
+	_, err = ai.NewDeepSeekService("deepseek-key", server.URL+"/v2").Complete(context.Background(), "hi")
+	if err == nil || !strings.Contains(err.Error(), "unexpected request") {
+		t.Errorf("Expected the error to include the response body, got %v", err)
+	}
+}
+
+func TestGeminiStructuredOutput(t *testing.T) {
+	valid := `{"segments": [{"start": 0, "end": 1.8, "speaker": "Speaker 1", "text": "We ship on Friday."},
+		{"start": 1.8, "end": 3, "speaker": "Speaker 2", "text": "Great."}],
+		"summary": "The release is on Friday.", "key_points": ["Friday release"],
+		"title": "Release date", "language": "en", "action_items": ["Prepare the release notes"]}`
+
+	// The fake model first leaves out the summary, then corrects itself
+	var requests []ai.GeminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ai.GeminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/model:generateContent" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, req)
+
+		output := `{"segments": [{"start": 0, "end": 1.8, "speaker": "Speaker 1", "text": "We ship on Friday."}]}`
+		if len(requests) > 1 {
+			output = valid
+		}
+
+		text, _ := json.Marshal(output)
+		fmt.Fprintf(w, `{"candidates": [{"content": {"parts": [{"text": %s}]}}]}`, text)
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "memo.m4a")
+	if err := os.WriteFile(audioPath, []byte("fake audio"), 0644); err != nil {
+		t.Fatalf("Failed to write audio file: %v", err)
+	}
+
+	gemini := ai.NewGeminiService("gemini-key")
+	gemini.ModelURL = server.URL + "/model"
+
+	result, err := gemini.Transcribe(context.Background(), ai.TranscriptionRequest{AudioFilePath: audioPath, SummaryLanguage: "en"})
+	if err != nil {
+		t.Fatalf("Failed to transcribe: %v", err)
+	}
+
+	if result.Summary != "The release is on Friday." || result.Title != "Release date" || len(result.ActionItems) != 1 {
+		t.Errorf("Unexpected transcription: %+v", result)
+	}
+
+	// The transcript is assembled from the speaker-labelled segments
+	if result.Transcript != "We ship on Friday.\nGreat." || len(result.Segments) != 2 || result.Segments[1].Speaker != "Speaker 2" {
+		t.Errorf("Unexpected transcript segments: %q %+v", result.Transcript, result.Segments)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected one corrective retry, got %d requests", len(requests))
+	}
+
+	first := requests[0]
+	if first.GenerationConfig == nil || first.GenerationConfig.ResponseMimeType != "application/json" || first.GenerationConfig.ResponseSchema == nil {
+		t.Errorf("Expected a JSON response schema in the request")
+	}
+
+	// The retry shows the model its invalid answer and what was wrong with it
+	retry := requests[1]
+	if len(retry.Contents) != 3 || retry.Contents[1].Role != "model" || !strings.Contains(retry.Contents[2].Parts[0].Text, `"summary"`) {
+		t.Errorf("Expected the retry to include the invalid answer and the validation error, got %+v", retry.Contents)
+	}
+
+	// A second invalid answer is an error rather than another retry
+	requests = nil
+	valid = `{"segments": [], "summary": 42}`
+
+	_, err = gemini.Transcribe(context.Background(), ai.TranscriptionRequest{AudioFilePath: audioPath})
+	if err == nil {
+		t.Fatalf("Expected invalid output after the retry to fail")
+	}
+	if len(requests) != 2 {
+		t.Errorf("Expected exactly one retry, got %d requests", len(requests))
+	}
+}
@@ -0,0 +1,367 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/pgvector/pgvector-go"
+)
+
+// unitVector returns a 1536-dimension embedding pointing along one axis
+func unitVector(axis int) pgvector.Vector {
+	v := make([]float32, 1536)
+	v[axis] = 1
+	return pgvector.NewVector(v)
+}
+
+func TestHybridSearch(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "retrieval-test@example.com",
+		Name:      "Retrieval Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	folder := &data.Folder{Name: "Meetings", UserID: user.Id}
+	if err := pgContainer.Models.Folders.Insert(folder); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Vendor call",
+		AudioFilePath: "/path/to/vendor.mp3",
+		UserID:        user.Id,
+		FolderID:      &folder.ID,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	embeddings := pgContainer.Models.Embeddings
+
+	// The first chunk is semantically close to the query, the second shares
+	// the exact acronym with it
+	semantic := &data.NoteTranscriptEmbedding{
+		NoteID:          note.ID,
+		UserID:          user.Id,
+		FolderID:        &folder.ID,
+		TranscriptChunk: "we talked about the supplier contract renewal",
+		Embedding:       unitVector(0),
+	}
+	keyword := &data.NoteTranscriptEmbedding{
+		NoteID:          note.ID,
+		UserID:          user.Id,
+		FolderID:        &folder.ID,
+		TranscriptChunk: "ACME asked for a discount on the next order",
+		Embedding:       unitVector(1),
+	}
+
+	for _, e := range []*data.NoteTranscriptEmbedding{semantic, keyword} {
+		if err := embeddings.Insert(e); err != nil {
+			t.Fatalf("Failed to insert embedding: %v", err)
+		}
+	}
+
+	query := data.ChunkQuery{
+		UserID:    user.Id,
+		FolderIDs: []int64{folder.ID},
+		Text:      "what did ACME want",
+		Embedding: unitVector(0),
+		TopK:      5,
+	}
+
+	chunks, err := embeddings.HybridSearch(query)
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 2 {
+		t.Fatalf("Expected both chunks to be retrieved, got %d", len(chunks))
+	}
+
+	// The acronym chunk is found by both searches, so fusion ranks it above
+	// the chunk that only the vector search found
+	if chunks[0].ID != keyword.ID {
+		t.Errorf("Expected the acronym chunk to rank first, got chunk %d", chunks[0].ID)
+	}
+
+	if chunks[1].KeywordRank != nil {
+		t.Errorf("Expected the semantic chunk to have no keyword rank")
+	}
+
+	// Sources carry the note title and the cosine similarity to the query
+	if chunks[1].NoteTitle != note.Title {
+		t.Errorf("Expected note title %q, got %q", note.Title, chunks[1].NoteTitle)
+	}
+
+	if chunks[1].Similarity < 0.99 || chunks[0].Similarity > 0.01 {
+		t.Errorf("Expected similarities of 1 and 0, got %f and %f", chunks[1].Similarity, chunks[0].Similarity)
+	}
+
+	// A minimum score above a single-list hit keeps only the fused chunk
+	query.MinScore = 0.6
+
+	chunks, err = embeddings.HybridSearch(query)
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 1 || chunks[0].ID != keyword.ID {
+		t.Errorf("Expected only the acronym chunk above the minimum score, got %d chunks", len(chunks))
+	}
+}
+
+// fakeEmbedder returns the same embedding for every chunk
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) Name() string {
+	return "fake"
+}
+
+func (fakeEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return unitVector(0).Slice(), nil
+}
+
+// failingEmbedder fails to embed every chunk
+type failingEmbedder struct{}
+
+func (failingEmbedder) Name() string {
+	return "failing"
+}
+
+func (failingEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestQueryUnfiledNotes(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	var users []*data.User
+	for _, email := range []string{"owner@example.com", "other@example.com"} {
+		user := &data.User{
+			Email:     email,
+			Name:      "Query Test",
+			Activated: true,
+			Role:      data.TraineeRole,
+		}
+
+		err = user.Password.Set("password123")
+		if err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+
+		err = pgContainer.Models.Users.Insert(user)
+		if err != nil {
+			t.Fatalf("Failed to insert user: %v", err)
+		}
+
+		users = append(users, user)
+	}
+
+	embeddings := pgContainer.Models.Embeddings
+
+	// Each user gets one unfiled note
+	var notes []*data.Note
+	for _, user := range users {
+		note := &data.Note{
+			Title:         "Unfiled",
+			AudioFilePath: "/path/to/unfiled.mp3",
+			UserID:        user.Id,
+		}
+		if err := pgContainer.Models.Notes.Insert(note); err != nil {
+			t.Fatalf("Failed to insert note: %v", err)
+		}
+
+		err = embeddings.ProcessAndStoreEmbeddings(context.Background(), "notes without a folder are searchable", nil, note.ID, user.Id, nil, fakeEmbedder{})
+		if err != nil {
+			t.Fatalf("Failed to embed unfiled note: %v", err)
+		}
+
+		notes = append(notes, note)
+	}
+
+	chunks, err := embeddings.HybridSearch(data.ChunkQuery{
+		UserID:    users[0].Id,
+		Text:      "searchable",
+		Embedding: unitVector(0),
+		TopK:      5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 1 || chunks[0].NoteID != notes[0].ID {
+		t.Fatalf("Expected only the owner's unfiled note, got %d chunks", len(chunks))
+	}
+
+	// A note filter that excludes the note finds nothing
+	chunks, err = embeddings.HybridSearch(data.ChunkQuery{
+		UserID:    users[0].Id,
+		NoteIDs:   []int64{notes[1].ID},
+		Text:      "searchable",
+		Embedding: unitVector(0),
+		TopK:      5,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 0 {
+		t.Errorf("Expected no chunks outside the note filter, got %d", len(chunks))
+	}
+}
+
+func TestEmbeddingsFollowNoteMove(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "move-test@example.com",
+		Name:      "Move Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	folderModel := pgContainer.Models.Folders
+
+	// Work, with a Projects subfolder, and an unrelated Personal folder
+	work := &data.Folder{Name: "Work", UserID: user.Id}
+	if err := folderModel.Insert(work); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	projects := &data.Folder{Name: "Projects", UserID: user.Id, ParentID: &work.ID}
+	if err := folderModel.Insert(projects); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	personal := &data.Folder{Name: "Personal", UserID: user.Id}
+	if err := folderModel.Insert(personal); err != nil {
+		t.Fatalf("Failed to insert folder: %v", err)
+	}
+
+	subtree, err := folderModel.GetSubtreeIDs(work.ID)
+	if err != nil {
+		t.Fatalf("Failed to get folder subtree: %v", err)
+	}
+
+	if len(subtree) != 2 {
+		t.Errorf("Expected Work and Projects in the subtree, got %v", subtree)
+	}
+
+	note := &data.Note{
+		Title:         "Roadmap",
+		AudioFilePath: "/path/to/roadmap.mp3",
+		UserID:        user.Id,
+		FolderID:      &projects.ID,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	embeddings := pgContainer.Models.Embeddings
+
+	err = embeddings.ProcessAndStoreEmbeddings(context.Background(), "the roadmap for next year", nil, note.ID, user.Id, note.FolderID, fakeEmbedder{})
+	if err != nil {
+		t.Fatalf("Failed to embed note: %v", err)
+	}
+
+	query := data.ChunkQuery{
+		UserID:    user.Id,
+		FolderIDs: subtree,
+		Text:      "roadmap",
+		Embedding: unitVector(0),
+		TopK:      5,
+	}
+
+	chunks, err := embeddings.HybridSearch(query)
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 1 {
+		t.Fatalf("Expected the subfolder's note to be found from its parent, got %d chunks", len(chunks))
+	}
+
+	// Move the note out of the Work tree
+	note.FolderID = &personal.ID
+	if err := pgContainer.Models.Notes.UpdateFolder(note); err != nil {
+		t.Fatalf("Failed to move note: %v", err)
+	}
+
+	chunks, err = embeddings.HybridSearch(query)
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 0 {
+		t.Errorf("Expected the moved note to leave its old folder, got %d chunks", len(chunks))
+	}
+
+	query.FolderIDs = []int64{personal.ID}
+
+	chunks, err = embeddings.HybridSearch(query)
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) != 1 {
+		t.Errorf("Expected the moved note in its new folder, got %d chunks", len(chunks))
+	}
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+	"github.com/m0hh/Notes/internal/diff"
+)
+
+func TestNoteRevisions(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	// Create a test user
+	userModel := pgContainer.Models.Users
+	user := &data.User{
+		Email:     "revision-test@example.com",
+		Name:      "Revision Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = userModel.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Revision Note",
+		AudioFilePath: "/test/revision.mp3",
+		UserID:        user.Id,
+	}
+
+	err = pgContainer.Models.Notes.Insert(note)
+	if err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	revisionModel := pgContainer.Models.Revisions
+
+	// First revision comes from the pipeline
+	note.Transcript = sql.NullString{String: "hello wrld", Valid: true}
+	first, err := revisionModel.Insert(note, "whisper", nil)
+	if err != nil {
+		t.Fatalf("Failed to insert revision: %v", err)
+	}
+
+	if first.Revision != 1 {
+		t.Errorf("Expected revision 1, got %d", first.Revision)
+	}
+
+	// Second revision is a user correction
+	note.Transcript = sql.NullString{String: "hello world", Valid: true}
+	second, err := revisionModel.Insert(note, data.RevisionSourceUserEdit, &user.Id)
+	if err != nil {
+		t.Fatalf("Failed to insert revision: %v", err)
+	}
+
+	if second.Revision != 2 {
+		t.Errorf("Expected revision 2, got %d", second.Revision)
+	}
+
+	// Retrieve the first revision
+	retrieved, err := revisionModel.Get(note.ID, 1)
+	if err != nil {
+		t.Fatalf("Failed to get revision: %v", err)
+	}
+
+	if retrieved.Transcript.String != "hello wrld" {
+		t.Errorf("Expected transcript %q, got %q", "hello wrld", retrieved.Transcript.String)
+	}
+
+	// List revisions, newest first
+	filters := data.Filters{Page: 1, PageSize: 10}
+	revisions, metadata, err := revisionModel.GetAllForNote(note.ID, filters)
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+
+	if len(revisions) != 2 || metadata.TotalRecords != 2 {
+		t.Fatalf("Expected 2 revisions, got %d (total %d)", len(revisions), metadata.TotalRecords)
+	}
+
+	if revisions[0].Revision != 2 || revisions[0].Source != data.RevisionSourceUserEdit {
+		t.Errorf("Expected newest revision to be the user edit, got %+v", revisions[0])
+	}
+
+	// Saves that race each other all get a revision of their own
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := revisionModel.Insert(note, data.RevisionSourceReprocess, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to insert concurrent revision: %v", err)
+		}
+	}
+
+	_, metadata, err = revisionModel.GetAllForNote(note.ID, filters)
+	if err != nil {
+		t.Fatalf("Failed to list revisions: %v", err)
+	}
+	if metadata.TotalRecords != 12 {
+		t.Errorf("Expected 12 revisions, got %d", metadata.TotalRecords)
+	}
+}
+
+func TestWordDiff(t *testing.T) {
+	ops := diff.Words("the quick brown fox", "the slow brown fox jumps")
+
+	expected := []diff.Op{
+		{Type: diff.Equal, Text: "the"},
+		{Type: diff.Delete, Text: "quick"},
+		{Type: diff.Insert, Text: "slow"},
+		{Type: diff.Equal, Text: "brown fox"},
+		{Type: diff.Insert, Text: "jumps"},
+	}
+
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %d operations, got %d: %+v", len(expected), len(ops), ops)
+	}
+
+	for i := range expected {
+		if ops[i] != expected[i] {
+			t.Errorf("Operation %d: expected %+v, got %+v", i, expected[i], ops[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestSearchNotes(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "search-test@example.com",
+		Name:      "Search Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	noteModel := pgContainer.Models.Notes
+
+	transcripts := map[string]string{
+		"Budget meeting": "we agreed to reduce the marketing budget for the next quarter",
+		"Lecture":        "photosynthesis converts light energy into chemical energy",
+		"Budget review":  "nothing about money here",
+	}
+
+	for title, transcript := range transcripts {
+		note := &data.Note{
+			Title:         title,
+			AudioFilePath: "/path/to/" + strings.ReplaceAll(title, " ", "_") + ".mp3",
+			UserID:        user.Id,
+		}
+		if err := noteModel.Insert(note); err != nil {
+			t.Fatalf("Failed to insert note: %v", err)
+		}
+
+		previous := note.Content()
+		note.Transcript = sql.NullString{String: transcript, Valid: true}
+		if err := noteModel.UpdateTranscript(note, previous); err != nil {
+			t.Fatalf("Failed to update transcript: %v", err)
+		}
+	}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     10,
+		Sort:         "-rank",
+		SortSafelist: []string{"-rank"},
+	}
+
+	results, metadata, err := noteModel.Search(user.Id, data.NoteSearch{Query: "budget"}, filters)
+	if err != nil {
+		t.Fatalf("Failed to search notes: %v", err)
+	}
+
+	if metadata.TotalRecords != 2 {
+		t.Fatalf("Expected 2 matching notes, got %d", metadata.TotalRecords)
+	}
+
+	// The match in both the title and the transcript ranks first
+	if results[0].Note.Title != "Budget meeting" {
+		t.Errorf("Expected 'Budget meeting' to rank first, got %q", results[0].Note.Title)
+	}
+
+	if !strings.Contains(results[0].Headline, "<mark>budget</mark>") {
+		t.Errorf("Expected the headline to highlight the match, got %q", results[0].Headline)
+	}
+
+	// Status filters narrow the results
+	_, metadata, err = noteModel.Search(user.Id, data.NoteSearch{Query: "budget", Status: data.NoteStatusFailed}, filters)
+	if err != nil {
+		t.Fatalf("Failed to search notes: %v", err)
+	}
+
+	if metadata.TotalRecords != 0 {
+		t.Errorf("Expected no failed notes to match, got %d", metadata.TotalRecords)
+	}
+}
@@ -0,0 +1,214 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestTranscriptSegments(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "segments-test@example.com",
+		Name:      "Segments Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Interview",
+		AudioFilePath: "/path/to/interview.mp3",
+		UserID:        user.Id,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	segmentModel := pgContainer.Models.Segments
+
+	err = segmentModel.ReplaceForNote(note.ID, []*data.TranscriptSegment{
+		{Start: 0, End: 2.5, Speaker: "Speaker 1", Text: "Thanks for joining."},
+		{Start: 2.5, End: 4, Text: "Happy to be here."},
+	})
+	if err != nil {
+		t.Fatalf("Failed to store segments: %v", err)
+	}
+
+	segments, err := segmentModel.GetForNote(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get segments: %v", err)
+	}
+
+	if len(segments) != 2 {
+		t.Fatalf("Expected 2 segments, got %d", len(segments))
+	}
+
+	if segments[0].Position != 1 || segments[0].Speaker != "Speaker 1" || segments[1].Speaker != "" || segments[1].End != 4 {
+		t.Errorf("Unexpected segments: %+v %+v", segments[0], segments[1])
+	}
+
+	if !data.SegmentsMatchTranscript("Thanks for joining.\nHappy to be here.", segments) {
+		t.Errorf("Expected the segments to match the transcript they spell out")
+	}
+	if data.SegmentsMatchTranscript("Thanks for joining. Glad to be here.", segments) {
+		t.Errorf("Expected the segments not to match an edited transcript")
+	}
+
+	// A new transcription replaces the old segments
+	err = segmentModel.ReplaceForNote(note.ID, []*data.TranscriptSegment{{Start: 0, End: 1, Text: "Hello."}})
+	if err != nil {
+		t.Fatalf("Failed to replace segments: %v", err)
+	}
+
+	segments, err = segmentModel.GetForNote(note.ID)
+	if err != nil {
+		t.Fatalf("Failed to get segments: %v", err)
+	}
+
+	if len(segments) != 1 || segments[0].Text != "Hello." {
+		t.Errorf("Expected only the new segment, got %d", len(segments))
+	}
+}
+
+func TestSegmentChunkTimeRanges(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "chunk-times-test@example.com",
+		Name:      "Chunk Times Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Lecture",
+		AudioFilePath: "/path/to/lecture.mp3",
+		UserID:        user.Id,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	// Ten segments of 100 words, each ten seconds long, make several chunks
+	var segments []*data.TranscriptSegment
+	var texts []string
+	for i := 0; i < 10; i++ {
+		text := strings.TrimSpace(strings.Repeat(fmt.Sprintf("word%d ", i), 100))
+		segments = append(segments, &data.TranscriptSegment{Start: float64(i * 10), End: float64(i*10 + 10), Text: text})
+		texts = append(texts, text)
+	}
+	transcript := strings.Join(texts, "\n")
+
+	embeddings := pgContainer.Models.Embeddings
+
+	err = embeddings.ProcessAndStoreEmbeddings(context.Background(), transcript, segments, note.ID, user.Id, nil, fakeEmbedder{})
+	if err != nil {
+		t.Fatalf("Failed to embed note: %v", err)
+	}
+
+	chunks, err := embeddings.HybridSearch(data.ChunkQuery{
+		UserID:    user.Id,
+		Text:      "word9",
+		Embedding: unitVector(0),
+		TopK:      10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) < 2 {
+		t.Fatalf("Expected the transcript to be split into several chunks, got %d", len(chunks))
+	}
+
+	// Chunks follow segment boundaries, so the last one ends with the audio
+	var last *data.RetrievedChunk
+	for _, chunk := range chunks {
+		if chunk.StartSeconds == nil || chunk.EndSeconds == nil {
+			t.Fatalf("Expected chunk %d to have a time range", chunk.ID)
+		}
+		if last == nil || *chunk.EndSeconds > *last.EndSeconds {
+			last = chunk
+		}
+	}
+
+	if *last.EndSeconds != 100 || !strings.HasSuffix(last.Text, "word9") {
+		t.Errorf("Expected the last chunk to end at 100s with the last segment, got %v: %q", *last.EndSeconds, last.Text)
+	}
+
+	// An edited transcript no longer matches its segments and loses the times
+	note.Transcript = sql.NullString{String: transcript + " and an edit", Valid: true}
+
+	err = embeddings.ProcessAndStoreEmbeddings(context.Background(), note.Transcript.String, segments, note.ID, user.Id, nil, fakeEmbedder{})
+	if err != nil {
+		t.Fatalf("Failed to embed note: %v", err)
+	}
+
+	chunks, err = embeddings.HybridSearch(data.ChunkQuery{
+		UserID:    user.Id,
+		Text:      "edit",
+		Embedding: unitVector(0),
+		TopK:      10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run hybrid search: %v", err)
+	}
+
+	if len(chunks) == 0 || chunks[0].StartSeconds != nil {
+		t.Errorf("Expected chunks of an edited transcript to have no time range")
+	}
+	// Chunks shorter than the part quoted in errors are reported without
+	// panicking, and multi-byte characters aren't cut in half
+	for _, short := range []string{"hi", "ça va très bien, merci à vous"} {
+		err = embeddings.ProcessAndStoreEmbeddings(context.Background(), short, nil, note.ID, user.Id, nil, failingEmbedder{})
+		if err == nil || !strings.Contains(err.Error(), short) {
+			t.Errorf("Expected the embedder's error quoting the chunk, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/m0hh/Notes/internal/ai"
+	"github.com/m0hh/Notes/internal/data"
+)
+
+// echoChatModel answers with the text it was asked to translate, upper-cased,
+// and records the prompts it got. It fails when the request has no deadline.
+type echoChatModel struct {
+	prompts *[]string
+}
+
+func (m echoChatModel) Name() string {
+	return "echo"
+}
+
+func (m echoChatModel) Complete(ctx context.Context, prompt string) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return "", errors.New("no deadline")
+	}
+	*m.prompts = append(*m.prompts, prompt)
+	_, text, _ := strings.Cut(prompt, "Text:\n")
+	return strings.ToUpper(text), nil
+}
+
+func (m echoChatModel) Stream(ctx context.Context, prompt string, onToken ai.TokenHandler) (string, error) {
+	return m.Complete(ctx, prompt)
+}
+
+func TestTranslate(t *testing.T) {
+	var prompts []string
+	model := echoChatModel{prompts: &prompts}
+
+	translated, err := ai.Translate(context.Background(), model, "Speaker 1: hello\nSpeaker 2: bye", "fr")
+	if err != nil {
+		t.Fatalf("Failed to translate: %v", err)
+	}
+
+	if translated != "SPEAKER 1: HELLO\nSPEAKER 2: BYE" {
+		t.Errorf("Unexpected translation %q", translated)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "French (fr)") {
+		t.Errorf("Expected one prompt naming the target language, got %q", prompts)
+	}
+
+	// Long text is translated a part at a time, without losing lines
+	line := strings.Repeat("word ", 200)
+	long := strings.TrimSpace(strings.Repeat(line+"\n", 20))
+
+	prompts = nil
+	translated, err = ai.Translate(context.Background(), model, long, "de")
+	if err != nil {
+		t.Fatalf("Failed to translate: %v", err)
+	}
+
+	if len(prompts) < 2 {
+		t.Errorf("Expected long text to be split, got %d prompts", len(prompts))
+	}
+	if strings.Count(translated, "WORD") != 20*200 {
+		t.Errorf("Expected every word to be translated, got %d", strings.Count(translated, "WORD"))
+	}
+
+	failing := fakeChatModel{name: "down", err: errors.New("unavailable")}
+	if _, err := ai.Translate(context.Background(), failing, "hello", "fr"); err == nil {
+		t.Error("Expected the model's error to be returned")
+	}
+}
+
+func TestNoteTranslations(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "translations-test@example.com",
+		Name:      "Translations Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Lecture 1",
+		AudioFilePath: "/path/to/lecture1.mp3",
+		UserID:        user.Id,
+	}
+	if err := pgContainer.Models.Notes.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	translationModel := pgContainer.Models.Translations
+
+	translation := &data.NoteTranslation{
+		NoteID:        note.ID,
+		Language:      "fr",
+		SourceVersion: note.Version,
+	}
+	if err := translationModel.Request(translation); err != nil {
+		t.Fatalf("Failed to request translation: %v", err)
+	}
+
+	if translation.Status != data.TranslationStatusPending {
+		t.Errorf("Expected a new translation to be pending, got %q", translation.Status)
+	}
+
+	t.Run("Mark ready", func(t *testing.T) {
+		translation.Transcript = "Bonjour"
+		translation.Summary = "Salut"
+
+		if err := translationModel.MarkReady(translation); err != nil {
+			t.Fatalf("Failed to mark translation ready: %v", err)
+		}
+
+		got, err := translationModel.GetForNote(note.ID, "fr")
+		if err != nil {
+			t.Fatalf("Failed to get translation: %v", err)
+		}
+
+		if got.Status != data.TranslationStatusReady || got.Transcript != "Bonjour" || got.Summary != "Salut" {
+			t.Errorf("Unexpected ready translation: %+v", got)
+		}
+	})
+
+	t.Run("Request again", func(t *testing.T) {
+		stale := *translation
+
+		again := &data.NoteTranslation{
+			NoteID:        note.ID,
+			Language:      "fr",
+			Embed:         true,
+			SourceVersion: note.Version,
+		}
+		if err := translationModel.Request(again); err != nil {
+			t.Fatalf("Failed to request translation: %v", err)
+		}
+
+		if again.ID != translation.ID || again.Status != data.TranslationStatusPending {
+			t.Errorf("Expected the translation to start over, got %+v", again)
+		}
+
+		// A job still working on the earlier request loses
+		if err := translationModel.MarkReady(&stale); !errors.Is(err, data.ErrEditConflict) {
+			t.Errorf("Expected ErrEditConflict, got %v", err)
+		}
+
+		translations, err := translationModel.GetAllForNote(note.ID)
+		if err != nil {
+			t.Fatalf("Failed to list translations: %v", err)
+		}
+		if len(translations) != 1 || translations[0].Transcript != "" || !translations[0].Embed {
+			t.Errorf("Unexpected translations: %+v", translations)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		if err := translationModel.Delete(translation.ID); err != nil {
+			t.Fatalf("Failed to delete translation: %v", err)
+		}
+
+		if _, err := translationModel.GetForNote(note.ID, "fr"); !errors.Is(err, data.ErrRcordNotFound) {
+			t.Errorf("Expected the translation to be deleted, got %v", err)
+		}
+
+		if err := translationModel.Delete(translation.ID); !errors.Is(err, data.ErrRcordNotFound) {
+			t.Errorf("Expected deleting a missing translation to fail with ErrRcordNotFound, got %v", err)
+		}
+	})
+}
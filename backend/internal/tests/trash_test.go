@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m0hh/Notes/internal/data"
+)
+
+func TestTrashFolderSubtree(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "trash-test@example.com",
+		Name:      "Trash Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	folderModel := pgContainer.Models.Folders
+	noteModel := pgContainer.Models.Notes
+
+	// Build parent -> child, with a note in the child folder
+	parent := &data.Folder{Name: "Parent", UserID: user.Id}
+	if err := folderModel.Insert(parent); err != nil {
+		t.Fatalf("Failed to insert parent folder: %v", err)
+	}
+
+	child := &data.Folder{Name: "Child", UserID: user.Id, ParentID: &parent.ID}
+	if err := folderModel.Insert(child); err != nil {
+		t.Fatalf("Failed to insert child folder: %v", err)
+	}
+
+	note := &data.Note{
+		Title:         "Nested Note",
+		AudioFilePath: "/path/to/nested.mp3",
+		UserID:        user.Id,
+		FolderID:      &child.ID,
+	}
+	if err := noteModel.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	// Deleting the parent trashes the whole subtree
+	err = folderModel.SoftDelete(parent)
+	if err != nil {
+		t.Fatalf("Failed to soft delete folder: %v", err)
+	}
+
+	if _, err := folderModel.Get(child.ID); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected child folder to be hidden, got %v", err)
+	}
+
+	if _, err := noteModel.Get(note.ID); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected note to be hidden, got %v", err)
+	}
+
+	// Only the folder that was deleted directly is listed
+	folders, err := folderModel.GetTrash(user.Id)
+	if err != nil {
+		t.Fatalf("Failed to list trashed folders: %v", err)
+	}
+
+	if len(folders) != 1 || folders[0].ID != parent.ID {
+		t.Errorf("Expected only the parent folder in the trash, got %d folders", len(folders))
+	}
+
+	notes, err := noteModel.GetTrash(user.Id)
+	if err != nil {
+		t.Fatalf("Failed to list trashed notes: %v", err)
+	}
+
+	if len(notes) != 0 {
+		t.Errorf("Expected no notes listed on their own, got %d", len(notes))
+	}
+
+	// Restoring the parent brings everything back
+	err = folderModel.Restore(parent)
+	if err != nil {
+		t.Fatalf("Failed to restore folder: %v", err)
+	}
+
+	if _, err := folderModel.Get(child.ID); err != nil {
+		t.Errorf("Expected child folder to be restored, got %v", err)
+	}
+
+	if _, err := noteModel.Get(note.ID); err != nil {
+		t.Errorf("Expected note to be restored, got %v", err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	// Create a PostgreSQL container
+	pgContainer, err := NewPostgresContainer(t)
+	if err != nil {
+		t.Fatalf("Failed to create PostgreSQL container: %v", err)
+	}
+
+	// Defer container termination
+	defer func() {
+		if err := pgContainer.Terminate(context.Background()); err != nil {
+			t.Fatalf("Failed to terminate container: %v", err)
+		}
+	}()
+
+	user := &data.User{
+		Email:     "purge-test@example.com",
+		Name:      "Purge Test",
+		Activated: true,
+		Role:      data.TraineeRole,
+	}
+
+	err = user.Password.Set("password123")
+	if err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+
+	err = pgContainer.Models.Users.Insert(user)
+	if err != nil {
+		t.Fatalf("Failed to insert user: %v", err)
+	}
+
+	noteModel := pgContainer.Models.Notes
+
+	note := &data.Note{
+		Title:         "Trashed Note",
+		AudioFilePath: "/path/to/trashed.mp3",
+		UserID:        user.Id,
+	}
+	if err := noteModel.Insert(note); err != nil {
+		t.Fatalf("Failed to insert note: %v", err)
+	}
+
+	if err := noteModel.SoftDelete(note); err != nil {
+		t.Fatalf("Failed to soft delete note: %v", err)
+	}
+
+	// Nothing is old enough to be purged yet
+	paths, err := noteModel.PurgeDeleted(time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to purge trash: %v", err)
+	}
+
+	if len(paths) != 0 {
+		t.Errorf("Expected nothing to be purged, got %d notes", len(paths))
+	}
+
+	// A negative retention makes everything in the trash expired
+	paths, err = noteModel.PurgeDeleted(-time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to purge trash: %v", err)
+	}
+
+	if len(paths) != 1 || paths[0] != note.AudioFilePath {
+		t.Errorf("Expected the note's audio file to be returned, got %v", paths)
+	}
+
+	if _, err := noteModel.GetDeleted(note.ID); !errors.Is(err, data.ErrRcordNotFound) {
+		t.Errorf("Expected note to be purged, got %v", err)
+	}
+}
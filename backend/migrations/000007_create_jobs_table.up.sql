@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    id bigserial PRIMARY KEY,
+    kind text NOT NULL,
+    payload jsonb NOT NULL DEFAULT '{}',
+    status text NOT NULL DEFAULT 'queued',
+    attempts integer NOT NULL DEFAULT 0,
+    max_attempts integer NOT NULL DEFAULT 5,
+    last_error text,
+    run_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    locked_at timestamp with time zone,
+    locked_by text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+-- Workers poll for queued jobs that are due, oldest first
+CREATE INDEX IF NOT EXISTS jobs_status_run_at_idx ON jobs (status, run_at);
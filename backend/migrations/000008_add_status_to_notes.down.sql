@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS notes_user_id_status_idx;
+
+ALTER TABLE notes DROP COLUMN IF EXISTS failed_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS ready_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS embedding_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS summarizing_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS transcribing_at;
+ALTER TABLE notes DROP COLUMN IF EXISTS status_error;
+ALTER TABLE notes DROP COLUMN IF EXISTS status;
@@ -0,0 +1,12 @@
+ALTER TABLE notes ADD COLUMN status text NOT NULL DEFAULT 'uploaded';
+ALTER TABLE notes ADD COLUMN status_error text;
+ALTER TABLE notes ADD COLUMN transcribing_at timestamp(0) with time zone;
+ALTER TABLE notes ADD COLUMN summarizing_at timestamp(0) with time zone;
+ALTER TABLE notes ADD COLUMN embedding_at timestamp(0) with time zone;
+ALTER TABLE notes ADD COLUMN ready_at timestamp(0) with time zone;
+ALTER TABLE notes ADD COLUMN failed_at timestamp(0) with time zone;
+
+-- Notes processed before statuses existed already have their transcript
+UPDATE notes SET status = 'ready', ready_at = updated_at WHERE transcript IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS notes_user_id_status_idx ON notes (user_id, status);
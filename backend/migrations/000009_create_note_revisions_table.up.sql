@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS note_revisions (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    revision integer NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL, -- NULL when the change came from the AI pipeline
+    source text NOT NULL,
+    title text NOT NULL,
+    transcript text,
+    summary text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (note_id, revision)
+);
+
+-- Keep the content of already processed notes as their first revision
+INSERT INTO note_revisions (note_id, revision, source, title, transcript, summary, created_at)
+SELECT id, 1, 'gemini', title, transcript, summary, updated_at
+FROM notes
+WHERE transcript IS NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE notes ADD COLUMN deleted_at timestamp(0) with time zone;
+ALTER TABLE folders ADD COLUMN deleted_at timestamp(0) with time zone;
+
+-- Only trashed rows are indexed; they are looked up by the trash listing and the purge
+CREATE INDEX IF NOT EXISTS notes_deleted_at_idx ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS folders_deleted_at_idx ON folders (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,8 @@
+-- The 'simple' configuration does not stem, so it works for notes in any language
+ALTER TABLE notes ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple'::regconfig, coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple'::regconfig, coalesce(summary, '')), 'B') ||
+    setweight(to_tsvector('simple'::regconfig, coalesce(transcript, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS notes_search_vector_idx ON notes USING GIN (search_vector);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS note_transcript_embeddings_chunk_tsv_idx;
+
+ALTER TABLE note_transcript_embeddings DROP COLUMN IF EXISTS chunk_tsv;
@@ -0,0 +1,5 @@
+-- Keyword index over the embedded chunks for hybrid retrieval
+ALTER TABLE note_transcript_embeddings ADD COLUMN chunk_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple'::regconfig, transcript_chunk)) STORED;
+
+CREATE INDEX IF NOT EXISTS note_transcript_embeddings_chunk_tsv_idx ON note_transcript_embeddings USING GIN (chunk_tsv);
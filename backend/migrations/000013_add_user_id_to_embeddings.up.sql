@@ -0,0 +1,21 @@
+-- Embeddings are scoped by user so notes without a folder can be queried too
+ALTER TABLE note_transcript_embeddings ADD COLUMN user_id bigint REFERENCES users(id) ON DELETE CASCADE;
+
+UPDATE note_transcript_embeddings e
+SET user_id = n.user_id
+FROM notes n
+WHERE n.id = e.note_id;
+
+DELETE FROM note_transcript_embeddings WHERE user_id IS NULL;
+
+ALTER TABLE note_transcript_embeddings ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS note_transcript_embeddings_user_id_idx ON note_transcript_embeddings (user_id);
+
+-- Unfiled notes could never be embedded; queue them now
+INSERT INTO jobs (kind, payload)
+SELECT 'embed_note', jsonb_build_object('note_id', n.id)
+FROM notes n
+WHERE n.transcript IS NOT NULL
+  AND n.deleted_at IS NULL
+  AND NOT EXISTS (SELECT 1 FROM note_transcript_embeddings e WHERE e.note_id = n.id);
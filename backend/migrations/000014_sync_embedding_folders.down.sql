@@ -0,0 +1,4 @@
+ALTER TABLE note_transcript_embeddings DROP CONSTRAINT IF EXISTS note_transcript_embeddings_folder_id_fkey;
+ALTER TABLE note_transcript_embeddings
+    ADD CONSTRAINT note_transcript_embeddings_folder_id_fkey
+    FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE CASCADE;
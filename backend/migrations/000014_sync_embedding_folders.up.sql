@@ -0,0 +1,11 @@
+-- Chunks of notes moved before embeddings followed their note still point at the old folder
+UPDATE note_transcript_embeddings e
+SET folder_id = n.folder_id, updated_at = NOW()
+FROM notes n
+WHERE n.id = e.note_id AND e.folder_id IS DISTINCT FROM n.folder_id;
+
+-- Embeddings belong to their note; removing a folder must not delete them
+ALTER TABLE note_transcript_embeddings DROP CONSTRAINT IF EXISTS note_transcript_embeddings_folder_id_fkey;
+ALTER TABLE note_transcript_embeddings
+    ADD CONSTRAINT note_transcript_embeddings_folder_id_fkey
+    FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE SET NULL;
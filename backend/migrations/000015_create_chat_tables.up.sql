@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS chat_sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    folder_id bigint REFERENCES folders ON DELETE SET NULL, -- NULL chats over all of the user's notes
+    include_descendants boolean NOT NULL DEFAULT false,
+    title text NOT NULL,
+    summary text NOT NULL DEFAULT '', -- rolling summary of the turns no longer sent verbatim
+    summarized_through bigint NOT NULL DEFAULT 0, -- last message folded into the summary
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS chat_sessions_user_id_idx ON chat_sessions (user_id, updated_at DESC);
+
+CREATE TABLE IF NOT EXISTS chat_messages (
+    id bigserial PRIMARY KEY,
+    session_id bigint NOT NULL REFERENCES chat_sessions ON DELETE CASCADE,
+    role text NOT NULL,
+    content text NOT NULL,
+    search_query text, -- standalone query used for retrieval, for user messages
+    sources jsonb, -- cited sources, for assistant messages
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS chat_messages_session_id_idx ON chat_messages (session_id, id);
@@ -0,0 +1,2 @@
+-- The processing pipeline the user prefers; empty means the server default
+ALTER TABLE users ADD COLUMN pipeline text NOT NULL DEFAULT '';
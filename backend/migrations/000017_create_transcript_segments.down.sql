@@ -0,0 +1,3 @@
+ALTER TABLE note_transcript_embeddings DROP COLUMN IF EXISTS end_seconds;
+ALTER TABLE note_transcript_embeddings DROP COLUMN IF EXISTS start_seconds;
+DROP TABLE IF EXISTS transcript_segments;
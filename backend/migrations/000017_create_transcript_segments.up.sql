@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS transcript_segments (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    position integer NOT NULL,
+    start_seconds double precision NOT NULL, -- offsets into the note's audio
+    end_seconds double precision NOT NULL,
+    speaker text, -- NULL when the provider doesn't tell speakers apart
+    text text NOT NULL,
+    UNIQUE (note_id, position)
+);
+
+-- Time range of the audio an embedded chunk was taken from, NULL when the
+-- transcript had no segments
+ALTER TABLE note_transcript_embeddings ADD COLUMN IF NOT EXISTS start_seconds double precision;
+ALTER TABLE note_transcript_embeddings ADD COLUMN IF NOT EXISTS end_seconds double precision;
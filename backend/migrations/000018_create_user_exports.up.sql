@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS user_exports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    status text NOT NULL DEFAULT 'pending',
+    file_path text, -- set once the archive is ready
+    error text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone,
+    expires_at timestamp(0) with time zone -- the archive is deleted after this
+);
+
+CREATE INDEX IF NOT EXISTS user_exports_user_id_idx ON user_exports (user_id);
+CREATE INDEX IF NOT EXISTS user_exports_expires_at_idx ON user_exports (expires_at) WHERE expires_at IS NOT NULL;
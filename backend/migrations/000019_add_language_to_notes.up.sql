@@ -0,0 +1,3 @@
+-- BCP-47 tag of the language spoken in the note's audio, as detected by the
+-- transcription provider or given on upload. NULL until it is transcribed.
+ALTER TABLE notes ADD COLUMN IF NOT EXISTS language text;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS note_transcript_embeddings_translation_id_idx;
+ALTER TABLE note_transcript_embeddings DROP COLUMN IF EXISTS translation_id;
+DROP TABLE IF EXISTS note_translations;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS note_translations (
+    id bigserial PRIMARY KEY,
+    note_id bigint NOT NULL REFERENCES notes ON DELETE CASCADE,
+    language text NOT NULL, -- BCP-47 tag of the target language
+    status text NOT NULL DEFAULT 'pending',
+    transcript text,
+    summary text,
+    error text,
+    embed boolean NOT NULL DEFAULT false,
+    source_version integer NOT NULL, -- version of the note that was translated
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    UNIQUE (note_id, language)
+);
+
+-- Chunks of a translated transcript point at their translation; the note's
+-- own chunks leave it NULL
+ALTER TABLE note_transcript_embeddings
+    ADD COLUMN IF NOT EXISTS translation_id bigint REFERENCES note_translations ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS note_transcript_embeddings_translation_id_idx ON note_transcript_embeddings (translation_id);
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE CASCADE, -- NULL for built-in templates
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    body text NOT NULL, -- may use {{title}}, {{folder}}, {{language}}, {{transcript_language}} and {{date}}
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS prompt_templates_user_id_idx ON prompt_templates (user_id);
+
+INSERT INTO prompt_templates (name, description, body) VALUES
+(
+    'Meeting minutes',
+    'Decisions, action items with owners and open questions from a meeting',
+    'This is a recording of a meeting titled "{{title}}". Write meeting minutes in {{language}}: the attendees as far as they can be told apart, the topics discussed, every decision taken, the action items with their owners and deadlines, and the questions left open'
+),
+(
+    'Lecture notes',
+    'Structured study notes with definitions and examples',
+    'This is a recording of a lecture titled "{{title}}". Write study notes in {{language}} that follow the structure of the lecture, with its main concepts, definitions, formulas, examples and anything the lecturer said would be on the exam'
+),
+(
+    'Interview',
+    'Questions and answers, quotes and themes from an interview',
+    'This is a recording of an interview titled "{{title}}". Summarize it in {{language}} as the questions asked with the substance of each answer, followed by the most notable quotes word for word and the recurring themes'
+),
+(
+    'Voice memo',
+    'A short summary with any to-dos and reminders',
+    'This is a personal voice memo titled "{{title}}", recorded on {{date}}. Summarize it briefly in {{language}} and list any to-dos, reminders, dates or ideas it mentions'
+);
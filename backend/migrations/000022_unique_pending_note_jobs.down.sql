@@ -0,0 +1 @@
+DROP INDEX IF EXISTS jobs_pending_note_processing_idx;
@@ -0,0 +1,4 @@
+-- A note is processed by at most one job at a time: a second run queued while
+-- one is waiting or running would overwrite the other's results
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_pending_note_processing_idx ON jobs (((payload->>'note_id')::bigint))
+    WHERE status IN ('queued', 'running') AND kind IN ('process_note_audio', 'regenerate_summary');
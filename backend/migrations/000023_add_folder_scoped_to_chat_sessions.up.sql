@@ -0,0 +1,5 @@
+-- A chat started over a folder keeps its scope after the folder is purged and
+-- folder_id is cleared, instead of widening to all of the user's notes
+ALTER TABLE chat_sessions ADD COLUMN IF NOT EXISTS folder_scoped boolean NOT NULL DEFAULT false;
+
+UPDATE chat_sessions SET folder_scoped = true WHERE folder_id IS NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS folder_imports;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS folder_imports (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    parent_id bigint REFERENCES folders ON DELETE SET NULL,
+    has_parent boolean NOT NULL DEFAULT false, -- false to import at the top level; a NULL parent_id then means it was purged
+    name text NOT NULL, -- the archive's name, for audio files at its top
+    archive_path text NOT NULL, -- removed once the import is done
+    status text NOT NULL DEFAULT 'pending',
+    folder_count integer NOT NULL DEFAULT 0,
+    note_count integer NOT NULL DEFAULT 0,
+    error text,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS folder_imports_user_id_idx ON folder_imports (user_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS jobs_pending_chat_summary_idx;
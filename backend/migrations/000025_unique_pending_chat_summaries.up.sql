@@ -0,0 +1,4 @@
+-- A chat has at most one summary waiting or running: it folds in every turn
+-- there is when it runs, so a second one would only repeat the work
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_pending_chat_summary_idx ON jobs (((payload->>'session_id')::bigint))
+    WHERE status IN ('queued', 'running') AND kind = 'summarize_chat';